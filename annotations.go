@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// sendConfig is effective configuration of sending logs of single pod.
+type sendConfig struct {
+	ignored   bool
+	dest      destination
+	tailLines *int64
+}
+
+// annotationOverride changes send config by value of pod annotation which
+// key is configured by flag, empty key disables override.
+type annotationOverride struct {
+	key   *string
+	apply func(cfg *sendConfig, value string) error
+}
+
+// annotationOverrides are applied in order, so topic annotation overrides
+// topic of chat annotation. New per pod overrides are added here.
+var annotationOverrides = []annotationOverride{
+	{
+		key: &ignoreAnnotation,
+		apply: func(cfg *sendConfig, value string) error {
+			ignored, err := strconv.ParseBool(value)
+			cfg.ignored = ignored
+			return err
+		},
+	},
+	{
+		key: &chatIDAnnotation,
+		apply: func(cfg *sendConfig, value string) error {
+			dest, err := parseDestination(value)
+			if err != nil {
+				return err
+			}
+			cfg.dest = dest
+			return nil
+		},
+	},
+	{
+		key: &topicAnnotation,
+		apply: func(cfg *sendConfig, value string) error {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			cfg.dest.topicID = id
+			return nil
+		},
+	},
+	{
+		key: &tailAnnotation,
+		apply: func(cfg *sendConfig, value string) error {
+			lines, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			if lines <= 0 {
+				return fmt.Errorf("tail lines must be positive")
+			}
+			cfg.tailLines = &lines
+			return nil
+		},
+	},
+}
+
+// resolveSendConfig returns send config of pod container, empty container
+// name means whole pod. Destination is resolved in order: pod annotations,
+// matched LogForwardTarget, route by pod name, route from --route-configmap,
+// route by namespace, global --chat-id and --telegram-topic-id. Invalid
+// annotations are ignored.
+func resolveSendConfig(pod *v1.Pod, containerName string) sendConfig {
+	cfg := sendConfig{
+		dest:      routeDestination(pod, containerName),
+		tailLines: tailLines,
+	}
+
+	if pod == nil {
+		return cfg
+	}
+
+	annotations := pod.GetAnnotations()
+	for _, override := range annotationOverrides {
+		if len(*override.key) == 0 {
+			continue
+		}
+
+		value, ok := annotations[*override.key]
+		if !ok {
+			continue
+		}
+
+		err := override.apply(&cfg, value)
+		if err != nil {
+			klog.Errorf("[resolveSendConfig] invalid annotation %s=%q of pod %s: %s", *override.key, value, pod.GetName(), err)
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveSendConfigPrecedence(t *testing.T) {
+	// every source routes pod to its own chat, sources are enabled from the
+	// lowest precedence up to level
+	const (
+		levelGlobal = iota
+		levelNamespaceRoute
+		levelConfigMapRoute
+		levelPodRoute
+		levelTarget
+		levelAnnotation
+	)
+
+	tests := []struct {
+		name  string
+		level int
+		want  destination
+	}{
+		{name: "global", level: levelGlobal, want: destination{chatID: 1, topicID: 10}},
+		{name: "namespace route", level: levelNamespaceRoute, want: destination{chatID: 2}},
+		{name: "configmap route", level: levelConfigMapRoute, want: destination{chatID: 3}},
+		{name: "pod route", level: levelPodRoute, want: destination{chatID: 4}},
+		{name: "target", level: levelTarget, want: destination{chatID: 5}},
+		{name: "annotation", level: levelAnnotation, want: destination{chatID: 6, topicID: 60}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedChatID, savedTopicID := chatID, topicID
+			savedNamespaceRoutes, savedPodRoutes := namespaceRoutes, podRoutes
+			savedConfigMapRoutes, savedTargets, savedWatchTargets := configMapRoutes, forwardTargets, watchTargets
+			savedChatIDAnnotation := chatIDAnnotation
+			defer func() {
+				chatID, topicID = savedChatID, savedTopicID
+				namespaceRoutes, podRoutes = savedNamespaceRoutes, savedPodRoutes
+				configMapRoutes, forwardTargets, watchTargets = savedConfigMapRoutes, savedTargets, savedWatchTargets
+				chatIDAnnotation = savedChatIDAnnotation
+			}()
+
+			chatID, topicID = 1, 10
+			namespaceRoutes, podRoutes = nil, nil
+			configMapRoutes, forwardTargets, watchTargets = map[string]destination{}, nil, false
+			chatIDAnnotation = "logs-sender/chat-id"
+
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "api-7d9c"}}
+
+			if tt.level >= levelNamespaceRoute {
+				namespaceRoutes = map[string]destination{"team": {chatID: 2}}
+			}
+			if tt.level >= levelConfigMapRoute {
+				configMapRoutes = map[string]destination{"team": {chatID: 3}}
+			}
+			if tt.level >= levelPodRoute {
+				podRoutes = []podRoute{{pattern: regexp.MustCompile("^api-"), template: "4"}}
+			}
+			if tt.level >= levelTarget {
+				watchTargets = true
+				forwardTargets = []forwardTarget{{name: "team/api", namespace: "team", dest: destination{chatID: 5}, hasDest: true}}
+			}
+			if tt.level >= levelAnnotation {
+				pod.Annotations = map[string]string{"logs-sender/chat-id": "6:60"}
+			}
+
+			if got := resolveSendConfig(pod, "").dest; got != tt.want {
+				t.Errorf("resolveSendConfig().dest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSendConfigInvalidAnnotation(t *testing.T) {
+	savedChatID, savedChatIDAnnotation, savedNamespaceRoutes := chatID, chatIDAnnotation, namespaceRoutes
+	defer func() {
+		chatID, chatIDAnnotation, namespaceRoutes = savedChatID, savedChatIDAnnotation, savedNamespaceRoutes
+	}()
+
+	chatID = 1
+	chatIDAnnotation = "logs-sender/chat-id"
+	namespaceRoutes = map[string]destination{"team": {chatID: 2}}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "team",
+		Name:        "api",
+		Annotations: map[string]string{"logs-sender/chat-id": "not-a-chat"},
+	}}
+
+	if got, want := resolveSendConfig(pod, "").dest, (destination{chatID: 2}); got != want {
+		t.Errorf("resolveSendConfig().dest = %+v, want %+v", got, want)
+	}
+}
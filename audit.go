@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// auditRecord is json line of audit log written for every send attempt,
+// kind is logs for sent logs and message for text messages.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Pod         string    `json:"pod,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	UID         string    `json:"uid,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Destination string    `json:"destination"`
+	Bytes       int       `json:"bytes"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var (
+	auditMu     sync.Mutex
+	auditWriter io.Writer
+)
+
+// openAudit opens audit log file for append, "-" means stdout.
+func openAudit(path string) error {
+	if path == "-" {
+		auditWriter = os.Stdout
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("[openAudit] failed open audit file %s: %s", path, err)
+	}
+	auditWriter = f
+
+	return nil
+}
+
+// writeAudit records send attempt of notification, sendErr is nil for
+// successful send.
+func writeAudit(n *notification, size int, sendErr error) {
+	writeAuditRecord(auditRecord{
+		Kind:      "logs",
+		Container: n.containerName,
+		Reason:    n.reason,
+		Bytes:     size,
+	}, n.pod, sendErr)
+}
+
+// writeAuditMessage records send attempt of text message, pod is nil for
+// messages not related to any pod.
+func writeAuditMessage(pod *v1.Pod, text string, sendErr error) {
+	writeAuditRecord(auditRecord{
+		Kind:  "message",
+		Bytes: len(text),
+	}, pod, sendErr)
+}
+
+// writeAuditRecord completes record with pod, destination and result of
+// send and appends it to audit log.
+func writeAuditRecord(record auditRecord, pod *v1.Pod, sendErr error) {
+	if auditWriter == nil {
+		return
+	}
+
+	record.Time = time.Now()
+	record.Destination = destinationName(pod)
+	record.Success = sendErr == nil
+	if pod != nil {
+		record.Namespace = pod.GetNamespace()
+		record.Pod = pod.GetName()
+		record.UID = string(pod.GetUID())
+	}
+	if sendErr != nil {
+		record.Error = sendErr.Error()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("[writeAuditRecord] failed marshal audit record: %s", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	_, err = auditWriter.Write(append(line, '\n'))
+	if err != nil {
+		klog.Errorf("[writeAuditRecord] failed write audit record: %s", err)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestSendMessageAudit(t *testing.T) {
+	pod := newTestPod("default", "audited")
+
+	_, restore := setupTest(t, pod)
+	defer restore()
+
+	savedAuditWriter := auditWriter
+	defer func() { auditWriter = savedAuditWriter }()
+	audit := new(bytes.Buffer)
+	auditWriter = audit
+
+	if err := sendMessage(context.Background(), pod, "pod failed"); err != nil {
+		t.Fatalf("sendMessage() error = %v", err)
+	}
+
+	var record auditRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil {
+		t.Fatalf("failed parse audit record %q: %v", audit.String(), err)
+	}
+
+	if record.Kind != "message" || record.Pod != "audited" || record.Bytes != len("pod failed") || !record.Success {
+		t.Errorf("audit record = %+v, want successful message of pod audited", record)
+	}
+}
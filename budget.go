@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/klog/v2"
+)
+
+// errInflightBudget is returned when logs buffered by concurrent sends
+// exceed --max-inflight-bytes.
+var errInflightBudget = errors.New("in-flight bytes budget exceeded")
+
+var (
+	inflightMu    sync.Mutex
+	inflightBytes int64
+	// inflightSkipped counts sends skipped because of exhausted budget
+	inflightSkipped uint64
+)
+
+type budgetKey struct{}
+
+// budgetAccount holds bytes buffered by single send.
+type budgetAccount struct {
+	mu    sync.Mutex
+	bytes int64
+}
+
+// withBudget returns context which accounts bytes of streamed logs and
+// function which frees them, it must be called when logs are sent.
+func withBudget(ctx context.Context) (context.Context, func()) {
+	if maxInflightBytes <= 0 {
+		return ctx, func() {}
+	}
+
+	account := &budgetAccount{}
+
+	return context.WithValue(ctx, budgetKey{}, account), func() {
+		account.mu.Lock()
+		n := account.bytes
+		account.bytes = 0
+		account.mu.Unlock()
+
+		inflightMu.Lock()
+		inflightBytes -= n
+		inflightMu.Unlock()
+	}
+}
+
+// budgetReader accounts every read chunk and fails read when budget is
+// exhausted, so logs are not buffered beyond budget. Single send may
+// exceed budget when nothing else is in flight, otherwise logs larger than
+// budget would never be sent.
+type budgetReader struct {
+	r       io.Reader
+	account *budgetAccount
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	inflightMu.Lock()
+	b.account.mu.Lock()
+	alone := inflightBytes == b.account.bytes
+	exceeded := inflightBytes+int64(n) > maxInflightBytes && !alone
+	if !exceeded {
+		inflightBytes += int64(n)
+		b.account.bytes += int64(n)
+	}
+	b.account.mu.Unlock()
+	inflightMu.Unlock()
+
+	if exceeded {
+		skipped := atomic.AddUint64(&inflightSkipped, 1)
+		klog.Warningf("In-flight bytes budget %d exceeded, skipped sends: %d", maxInflightBytes, skipped)
+		return 0, errInflightBudget
+	}
+
+	return n, err
+}
+
+// budgetedReader wraps reader to account bytes if context has budget.
+func budgetedReader(ctx context.Context, r io.Reader) io.Reader {
+	account, ok := ctx.Value(budgetKey{}).(*budgetAccount)
+	if !ok {
+		return r
+	}
+
+	return &budgetReader{r: r, account: account}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBudgetReader(t *testing.T) {
+	savedMaxInflightBytes := maxInflightBytes
+	defer func() { maxInflightBytes = savedMaxInflightBytes }()
+	maxInflightBytes = 4
+
+	logs := strings.Repeat("x", 16)
+
+	// single send larger than budget is not skipped
+	ctx, release := withBudget(context.Background())
+	data, err := ioutil.ReadAll(budgetedReader(ctx, strings.NewReader(logs)))
+	if err != nil || string(data) != logs {
+		t.Fatalf("read of single send = %q, %v, want whole logs", data, err)
+	}
+
+	// send is skipped while other send holds budget
+	otherCtx, otherRelease := withBudget(context.Background())
+	if _, err := ioutil.ReadAll(budgetedReader(otherCtx, strings.NewReader(logs))); err != errInflightBudget {
+		t.Errorf("read of concurrent send error = %v, want %v", err, errInflightBudget)
+	}
+	otherRelease()
+	release()
+
+	if inflightBytes != 0 {
+		t.Errorf("in-flight bytes after release = %d, want 0", inflightBytes)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// crashWindow tracks container crashes suppressed within coalesce window.
+type crashWindow struct {
+	lastFinishedAt time.Time
+	restarts       int
+	pod            *v1.Pod
+	containerName  string
+}
+
+var (
+	crashWindowsMu sync.Mutex
+	crashWindows   = map[string]*crashWindow{}
+)
+
+// coalesceCrash reports whether container crash logs should be sent now.
+// First crash opens window of --coalesce-window duration, repeated crashes
+// within window are suppressed and summarized when window ends.
+func coalesceCrash(ctx context.Context, pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	if coalesceWindow <= 0 {
+		return true
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetUID(), containerStatus.Name)
+	finishedAt := containerStatus.State.Terminated.FinishedAt.Time
+
+	crashWindowsMu.Lock()
+	defer crashWindowsMu.Unlock()
+
+	w, ok := crashWindows[key]
+	if !ok {
+		w = &crashWindow{lastFinishedAt: finishedAt}
+		crashWindows[key] = w
+		time.AfterFunc(coalesceWindow, func() { flushCrashWindow(ctx, key, w) })
+		return true
+	}
+
+	// pod updates without new crash report the same termination again
+	if !w.lastFinishedAt.Equal(finishedAt) {
+		w.lastFinishedAt = finishedAt
+		w.restarts++
+		w.pod = pod
+		w.containerName = containerStatus.Name
+	}
+
+	return false
+}
+
+// releaseCrash closes window opened by crash which logs are failed to send,
+// so crash is not suppressed on retry. Window with suppressed crashes is
+// kept, they are summarized when it ends.
+func releaseCrash(pod *v1.Pod, containerStatus v1.ContainerStatus) {
+	if coalesceWindow <= 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetUID(), containerStatus.Name)
+	finishedAt := containerStatus.State.Terminated.FinishedAt.Time
+
+	crashWindowsMu.Lock()
+	if w, ok := crashWindows[key]; ok && w.restarts == 0 && w.lastFinishedAt.Equal(finishedAt) {
+		delete(crashWindows, key)
+	}
+	crashWindowsMu.Unlock()
+}
+
+// flushCrashWindow closes window and sends summary of suppressed crashes.
+func flushCrashWindow(ctx context.Context, key string, w *crashWindow) {
+	crashWindowsMu.Lock()
+	// released window may be replaced by window of retried crash
+	if crashWindows[key] == w {
+		delete(crashWindows, key)
+	}
+	crashWindowsMu.Unlock()
+
+	if w.restarts == 0 {
+		return
+	}
+
+	text := fmt.Sprintf("pod: %s, container: %s restarted %d times in the last %s",
+		w.pod.GetName(), w.containerName, w.restarts, coalesceWindow)
+
+	klog.Infof("Send crash summary: %s", text)
+
+	err := sendMessage(ctx, w.pod, text)
+	if err != nil {
+		klog.Errorf("[flushCrashWindow] failed send summary: %s", err)
+		recordSendError(w.pod, err)
+	}
+
+	if coalesceSendLogs {
+		err = sendContainerLogs(ctx, w.pod, w.containerName, false)
+		if err != nil {
+			klog.Errorf("[flushCrashWindow] failed send container logs: %s", err)
+			recordSendError(w.pod, err)
+		}
+	}
+}
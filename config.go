@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// validateFlags checks dependent and mutually exclusive flags, all found
+// problems are returned at once.
+func validateFlags() error {
+	var errs []error
+
+	if usesNotifier("telegram") && chatID == 0 && len(routes) == 0 && len(routeConfigMap) == 0 && !watchTargets {
+		errs = append(errs, fmt.Errorf("--chat-id is required by telegram notifier unless --route, --route-configmap or --watch-targets is set"))
+	}
+
+	if len(notifierNames) == 0 {
+		errs = append(errs, fmt.Errorf("--notifier must not be empty"))
+	}
+
+	if logGrepContext > 0 && len(logGrep) == 0 {
+		errs = append(errs, fmt.Errorf("--log-grep-context requires --log-grep"))
+	}
+
+	if coalesceSendLogs && coalesceWindow <= 0 {
+		errs = append(errs, fmt.Errorf("--coalesce-send-logs requires --coalesce-window"))
+	}
+
+	if minRestarts > 0 && minRestartsReset <= 0 {
+		errs = append(errs, fmt.Errorf("--min-restarts requires positive --min-restarts-reset"))
+	}
+
+	if restartRateThreshold > 0 && restartRateWindow <= 0 {
+		errs = append(errs, fmt.Errorf("--restart-rate-threshold requires positive --restart-rate-window"))
+	}
+
+	if sendOnStabilize && stabilizeWindow <= 0 {
+		errs = append(errs, fmt.Errorf("--send-on-stabilize requires positive --stabilize-window"))
+	}
+
+	if sendOnStabilize && (groupByPod || waitForPodTerminated) {
+		errs = append(errs, fmt.Errorf("--send-on-stabilize can't be used with --group-by-pod or --wait-for-pod-terminated"))
+	}
+
+	if digest && digestInterval <= 0 {
+		errs = append(errs, fmt.Errorf("--digest requires positive --digest-interval"))
+	}
+
+	if len(stateFile) > 0 && stateFlushInterval <= 0 {
+		errs = append(errs, fmt.Errorf("--state-file requires positive --state-flush-interval"))
+	}
+
+	if minContainerDuration > 0 && maxContainerDuration > 0 && minContainerDuration > maxContainerDuration {
+		errs = append(errs, fmt.Errorf("--min-container-duration must not be greater than --max-container-duration"))
+	}
+
+	if sendRate > 0 && maxMessageParts > sendBurst {
+		errs = append(errs, fmt.Errorf("--max-message-parts must not be greater than --send-burst, every part is limited by --send-rate"))
+	}
+
+	if workers <= 0 {
+		errs = append(errs, fmt.Errorf("--workers must be positive"))
+	}
+
+	if once && enableLeaderElection {
+		errs = append(errs, fmt.Errorf("--once can't be used with --enable-leader-election"))
+	}
+
+	if once && digest {
+		errs = append(errs, fmt.Errorf("--once can't be used with --digest, digest is never flushed"))
+	}
+
+	if once && len(quietHoursWindow) > 0 && quietHoursMode == quietHoursBuffer {
+		errs = append(errs, fmt.Errorf("--once can't be used with buffered --quiet-hours, buffer is never flushed"))
+	}
+
+	switch matchMode {
+	case "any", "all":
+	default:
+		errs = append(errs, fmt.Errorf("unknown --match-mode %q", matchMode))
+	}
+
+	err := validateNotifyOn(notifyOn)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// printConfig writes effective configuration, secrets like webhook urls
+// and tokens are not written.
+func printConfig(out io.Writer) {
+	watched := namespace
+	if len(watched) == 0 {
+		watched = "all namespaces"
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "notifiers:\t%s\n", strings.Join(notifierNames, ", "))
+	fmt.Fprintf(w, "namespace:\t%s\n", watched)
+	if len(nodeName) > 0 {
+		fmt.Fprintf(w, "node:\t%s\n", nodeName)
+	}
+	if chatID != 0 {
+		fmt.Fprintf(w, "chat id:\t%d\n", chatID)
+	}
+	if len(routes) > 0 {
+		fmt.Fprintf(w, "routes:\t%s\n", strings.Join(routes, ", "))
+	}
+	if len(routeConfigMap) > 0 {
+		fmt.Fprintf(w, "route configmap:\t%s\n", routeConfigMap)
+	}
+	if len(podNames) > 0 {
+		fmt.Fprintf(w, "pod names:\t%s\n", strings.Join(podNames, ", "))
+	}
+	fmt.Fprintf(w, "pod name patterns:\t%s\n", strings.Join(podNamePatterns, ", "))
+	fmt.Fprintf(w, "container name patterns:\t%s\n", strings.Join(containerNamePatterns, ", "))
+	if len(containerImages) > 0 {
+		fmt.Fprintf(w, "container image patterns:\t%s, match mode: %s\n", strings.Join(containerImages, ", "), matchMode)
+	}
+	if watchTargets {
+		fmt.Fprintf(w, "log forward targets:\t%s\n", "watched")
+	}
+	if len(namespaceExcludes) > 0 {
+		fmt.Fprintf(w, "excluded namespaces:\t%s\n", strings.Join(namespaceExcludes, ", "))
+	}
+	fmt.Fprintf(w, "notify on:\t%s\n", notifyOn)
+	fmt.Fprintf(w, "tail lines:\t%d\n", *tailLines)
+	fmt.Fprintf(w, "max bytes:\t%d\n", maxBytes)
+	fmt.Fprintf(w, "group by pod:\t%t\n", groupByPod)
+	fmt.Fprintf(w, "workers:\t%d\n", workers)
+	fmt.Fprintf(w, "digest:\t%t\n", digest)
+	if len(quietHoursWindow) > 0 {
+		fmt.Fprintf(w, "quiet hours:\t%s %s, %s\n", quietHoursWindow, quietHoursTimezone, quietHoursMode)
+	}
+	fmt.Fprintf(w, "leader election:\t%t\n", enableLeaderElection)
+	w.Flush()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// podCooldown holds time of last sent logs of every container of pod.
+type podCooldown struct {
+	uid    types.UID
+	sentAt map[string]time.Time
+}
+
+var (
+	cooldownsMu sync.Mutex
+	// cooldowns holds last sent times by pod key
+	cooldowns = map[string]*podCooldown{}
+)
+
+// claimCooldown marks container logs as sent now, it returns false if
+// logs were sent within --notify-cooldown.
+func claimCooldown(pod *v1.Pod, containerName string) bool {
+	if notifyCooldown <= 0 {
+		return true
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	cooldownsMu.Lock()
+	defer cooldownsMu.Unlock()
+
+	c, ok := cooldowns[key]
+	if !ok || c.uid != pod.GetUID() {
+		c = &podCooldown{uid: pod.GetUID(), sentAt: map[string]time.Time{}}
+		cooldowns[key] = c
+	}
+
+	if sentAt, ok := c.sentAt[containerName]; ok && time.Since(sentAt) < notifyCooldown {
+		klog.V(4).Infof("Container %s is skipped, logs sent %s ago, within cooldown %s", containerName, time.Since(sentAt).Round(time.Second), notifyCooldown)
+		return false
+	}
+
+	c.sentAt[containerName] = time.Now()
+
+	return true
+}
+
+// releaseCooldown unmarks container logs as sent, so they may be sent
+// again before cooldown ends.
+func releaseCooldown(pod *v1.Pod, containerName string) {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	cooldownsMu.Lock()
+	if c, ok := cooldowns[key]; ok && c.uid == pod.GetUID() {
+		delete(c.sentAt, containerName)
+	}
+	cooldownsMu.Unlock()
+}
+
+// forgetCooldowns removes deleted pod from cooldowns.
+func forgetCooldowns(key string) {
+	cooldownsMu.Lock()
+	delete(cooldowns, key)
+	cooldownsMu.Unlock()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// deadLetter is metadata written next to logs which failed to send.
+type deadLetter struct {
+	Time        time.Time `json:"time"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Pod         string    `json:"pod,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	UID         string    `json:"uid,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Caption     string    `json:"caption,omitempty"`
+	Destination string    `json:"destination"`
+	Error       string    `json:"error"`
+}
+
+type finalAttemptKey struct{}
+
+// withFinalAttempt marks whether send is last attempt, logs failed on last
+// attempt are written to --dead-letter-dir.
+func withFinalAttempt(ctx context.Context, final bool) context.Context {
+	return context.WithValue(ctx, finalAttemptKey{}, final)
+}
+
+// isFinalAttempt reports whether send is not retried on failure, sends
+// outside of queue are never retried.
+func isFinalAttempt(ctx context.Context) bool {
+	final, ok := ctx.Value(finalAttemptKey{}).(bool)
+	return !ok || final
+}
+
+// writeDeadLetter writes logs failed to send on last attempt and json
+// metadata with failure reason to --dead-letter-dir.
+func writeDeadLetter(n *notification, logs []byte, sendErr error) {
+	name := n.fileName()
+	logPath := filepath.Join(deadLetterDir, name)
+
+	err := ioutil.WriteFile(logPath, logs, 0644)
+	if err != nil {
+		klog.Errorf("[writeDeadLetter] failed write logs to %s: %s", logPath, err)
+		return
+	}
+
+	letter := deadLetter{
+		Time:        time.Now(),
+		Container:   n.containerName,
+		Reason:      n.reason,
+		Caption:     n.caption,
+		Destination: destinationName(n.pod),
+		Error:       sendErr.Error(),
+	}
+	if n.pod != nil {
+		letter.Namespace = n.pod.GetNamespace()
+		letter.Pod = n.pod.GetName()
+		letter.UID = string(n.pod.GetUID())
+	}
+
+	data, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		klog.Errorf("[writeDeadLetter] failed marshal metadata: %s", err)
+		return
+	}
+
+	metaPath := fmt.Sprintf("%s.json", strings.TrimSuffix(logPath, filepath.Ext(logPath)))
+	err = ioutil.WriteFile(metaPath, data, 0644)
+	if err != nil {
+		klog.Errorf("[writeDeadLetter] failed write metadata to %s: %s", metaPath, err)
+		return
+	}
+
+	klog.Infof("Logs failed to send are written to %s", logPath)
+}
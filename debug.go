@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// maxRecentErrors is size of rolling buffer of recent send errors
+const maxRecentErrors = 100
+
+type sendError struct {
+	Time        time.Time `json:"time"`
+	Destination string    `json:"destination"`
+	Pod         string    `json:"pod,omitempty"`
+	Message     string    `json:"message"`
+}
+
+type debugErrors struct {
+	Requeues     map[string]int       `json:"requeues"`
+	LastErrors   map[string]sendError `json:"lastErrors"`
+	RecentErrors []sendError          `json:"recentErrors"`
+	WatchErrors  map[string]uint64    `json:"watchErrors"`
+	// LogFetches is number of container log streams in progress
+	LogFetches int64 `json:"logFetchesInFlight"`
+	// InflightSkipped is number of sends skipped by --max-inflight-bytes
+	InflightSkipped uint64 `json:"inflightSkipped"`
+	// Processed counts matched containers, sent logs, failed sends, rate
+	// limited messages and logs dropped during quiet hours
+	Processed map[string]uint64 `json:"processed"`
+}
+
+var (
+	debugMu      sync.Mutex
+	requeues     = map[string]int{}
+	lastErrors   = map[string]sendError{}
+	recentErrors []sendError
+	// watchErrors counts list and watch errors by namespace
+	watchErrors = map[string]uint64{}
+	processed   = map[string]uint64{}
+)
+
+// destinationName returns human readable destination of pod logs.
+func destinationName(pod *v1.Pod) string {
+	if usesNotifier("telegram") {
+		return fmt.Sprintf("telegram:%d", resolveDestination(pod, "").chatID)
+	}
+
+	return strings.Join(notifierNames, ",")
+}
+
+// recordSendError saves send error to be exposed on /debug/errors.
+func recordSendError(pod *v1.Pod, err error) {
+	e := sendError{
+		Time:        time.Now(),
+		Destination: destinationName(pod),
+		Message:     err.Error(),
+	}
+	if pod != nil {
+		e.Pod = fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+	}
+
+	debugMu.Lock()
+	defer debugMu.Unlock()
+
+	lastErrors[e.Destination] = e
+
+	recentErrors = append(recentErrors, e)
+	if len(recentErrors) > maxRecentErrors {
+		recentErrors = recentErrors[len(recentErrors)-maxRecentErrors:]
+	}
+}
+
+// recordRequeues saves num of requeues of key, zero removes key.
+func recordRequeues(key string, num int) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+
+	if num == 0 {
+		delete(requeues, key)
+		return
+	}
+
+	requeues[key] = num
+}
+
+// recordWatchError counts list or watch error of namespace pods.
+func recordWatchError(namespace string) {
+	debugMu.Lock()
+	watchErrors[namespace]++
+	debugMu.Unlock()
+}
+
+// recordProcessResult counts result of pod processing.
+func recordProcessResult(result processResult) {
+	debugMu.Lock()
+	processed["containers"] += uint64(result.containers)
+	processed["sent"] += uint64(result.sent)
+	processed["failed"] += uint64(len(result.errs))
+	debugMu.Unlock()
+}
+
+// recordRateLimited counts messages exceeded --send-rate.
+func recordRateLimited() {
+	debugMu.Lock()
+	processed["rateLimited"]++
+	debugMu.Unlock()
+}
+
+// recordQuietDropped counts logs dropped during quiet hours.
+func recordQuietDropped() {
+	debugMu.Lock()
+	processed["quietDropped"]++
+	debugMu.Unlock()
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func handleDebugErrors(w http.ResponseWriter, r *http.Request) {
+	debugMu.Lock()
+	data, err := json.Marshal(debugErrors{
+		Requeues:        requeues,
+		LastErrors:      lastErrors,
+		RecentErrors:    recentErrors,
+		WatchErrors:     watchErrors,
+		LogFetches:      atomic.LoadInt64(&logFetchesInFlight),
+		InflightSkipped: atomic.LoadUint64(&inflightSkipped),
+		Processed:       processed,
+	})
+	debugMu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveDebug starts health and debug http server.
+func serveDebug(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/debug/errors", handleDebugErrors)
+
+	klog.Infof("Starting debug server on %s", addr)
+
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		klog.Fatalf("failed start debug server: %s", err)
+	}
+}
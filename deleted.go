@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// isDeletedContainerShouldSend reports whether logs of deleted pod
+// container are sent. Containers of failed pod are sent, otherwise only
+// containers terminated with non-zero exit code or within --delay are
+// sent, so deletion of healthy pod sends nothing.
+func isDeletedContainerShouldSend(pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	if pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+
+	terminated := containerStatus.State.Terminated
+	if terminated == nil {
+		klog.V(4).Infof("Container %s of deleted pod is skipped, not terminated", containerStatus.Name)
+		return false
+	}
+
+	if terminated.ExitCode != 0 {
+		return true
+	}
+
+	if ago := time.Since(terminated.FinishedAt.Time); ago < time.Duration(delay)*time.Second {
+		return true
+	}
+
+	klog.V(4).Infof("Container %s of deleted pod is skipped, completed out of delay %ds", containerStatus.Name, delay)
+	return false
+}
+
+// processTerminatingPod sends logs of failed containers of pod deleted
+// with grace period, except terminations which logs are already sent. Logs
+// are sent while pod object exists, API server doesn't serve logs of
+// removed pod.
+func processTerminatingPod(ctx context.Context, pod *v1.Pod) processResult {
+	var result processResult
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if !isContainerMatched(pod, containerStatus) || !isDeletedContainerShouldSend(pod, containerStatus) {
+			continue
+		}
+
+		terminated := containerStatus.State.Terminated != nil
+		if terminated && !claimTermination(pod, containerStatus) {
+			continue
+		}
+
+		klog.Infof("Send logs from terminating pod: %s, container: %s", pod.GetName(), containerStatus.Name)
+
+		err := sendContainerLogs(ctx, pod, containerStatus.Name, false)
+		if err != nil {
+			klog.Errorf("[processTerminatingPod] failed send container logs: %s", err)
+			recordSendError(pod, err)
+			if terminated {
+				releaseTermination(pod, containerStatus)
+			}
+			result.errs = append(result.errs, err)
+			continue
+		}
+
+		result.sent++
+	}
+
+	return result
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// terminatingPod marks pod as deleted with grace period.
+func terminatingPod(pod *v1.Pod) *v1.Pod {
+	deletionTimestamp := metav1.Now()
+	pod.DeletionTimestamp = &deletionTimestamp
+
+	return pod
+}
+
+func TestProcessTerminatingPod(t *testing.T) {
+	tests := []struct {
+		name  string
+		phase v1.PodPhase
+		pod   *v1.Pod
+		want  []string
+	}{
+		{
+			name: "running containers",
+			pod:  newTestPod("default", "terminating-running", runningStatus("app")),
+		},
+		{
+			name:  "completed out of delay",
+			phase: v1.PodSucceeded,
+			pod:   newTestPod("default", "terminating-completed", terminatedStatus("app", "Completed", 0, time.Hour)),
+		},
+		{
+			name:  "completed within delay",
+			phase: v1.PodSucceeded,
+			pod:   newTestPod("default", "terminating-completed-recently", terminatedStatus("app", "Completed", 0, time.Second)),
+			want:  []string{"app"},
+		},
+		{
+			name: "non-zero exit code",
+			pod: newTestPod("default", "terminating-crashed",
+				terminatedStatus("app", "Error", 1, time.Hour),
+				runningStatus("proxy")),
+			want: []string{"app"},
+		},
+		{
+			name:  "failed pod",
+			phase: v1.PodFailed,
+			pod: newTestPod("default", "terminating-failed",
+				terminatedStatus("app", "Completed", 0, time.Hour),
+				terminatedStatus("proxy", "Error", 2, time.Hour)),
+			want: []string{"app", "proxy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := terminatingPod(tt.pod)
+			if len(tt.phase) > 0 {
+				pod.Status.Phase = tt.phase
+			}
+
+			recorder, restore := setupTest(t, pod)
+			defer restore()
+
+			savedOnDelete := onDelete
+			defer func() { onDelete = savedOnDelete }()
+			onDelete = true
+
+			if err := processPod(context.Background(), pod).err(); err != nil {
+				t.Fatalf("processPod() error = %v", err)
+			}
+
+			if got := recorder.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent containers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncStateDeletedPod(t *testing.T) {
+	pod := newTestPod("deleted", "crashed", terminatedStatus("app", "Error", 1, time.Hour))
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	savedOnDelete := onDelete
+	defer func() { onDelete = savedOnDelete }()
+	onDelete = true
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	c := NewController(queue, nil)
+	factory, informer := newPodInformer("deleted", queue, func(error) {})
+	c.podInformers["deleted"] = &podInformer{factory: factory, informer: informer}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+		t.Fatal("timed out waiting for caches to sync")
+	}
+
+	// termination out of delay is sent only while pod is terminating
+	if err := c.syncState(context.Background(), "deleted/crashed"); err != nil {
+		t.Fatalf("syncState() error = %v", err)
+	}
+	if got := recorder.sent(); len(got) != 0 {
+		t.Fatalf("sent containers of running pod = %v, want none", got)
+	}
+
+	terminating := terminatingPod(pod.DeepCopy())
+	if _, err := clientset.CoreV1().Pods("deleted").Update(context.Background(), terminating, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIndexer(t, informer, "deleted/crashed", func(obj interface{}, exists bool) bool {
+		return exists && obj.(*v1.Pod).DeletionTimestamp != nil
+	})
+
+	if err := c.syncState(context.Background(), "deleted/crashed"); err != nil {
+		t.Fatalf("syncState() error = %v", err)
+	}
+
+	// pod is removed from API server, so its logs are not served anymore
+	if err := clientset.CoreV1().Pods("deleted").Delete(context.Background(), "crashed", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIndexer(t, informer, "deleted/crashed", func(obj interface{}, exists bool) bool {
+		return !exists
+	})
+
+	if err := c.syncState(context.Background(), "deleted/crashed"); err != nil {
+		t.Fatalf("syncState() error = %v", err)
+	}
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+}
+
+// waitForIndexer waits until pod in informer cache satisfies condition.
+func waitForIndexer(t *testing.T, informer cache.SharedIndexInformer, key string, condition func(obj interface{}, exists bool) bool) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		obj, exists, err := informer.GetIndexer().GetByKey(key)
+		if err == nil && condition(obj, exists) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for pod %s in informer cache", key)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// anchorLines is number of last sent log lines searched in next logs to
+// find content which is already sent
+const anchorLines = 3
+
+// podAnchors holds last sent lines of every container of pod.
+type podAnchors struct {
+	uid     types.UID
+	anchors map[string][]byte
+}
+
+var (
+	anchorsMu sync.Mutex
+	// anchors holds last sent lines by pod key
+	anchors = map[string]*podAnchors{}
+)
+
+// logAnchor returns last lines of logs which identify end of sent content.
+func logAnchor(logs *bytes.Buffer) []byte {
+	lines := splitLogLines(logs.Bytes())
+	if len(lines) > anchorLines {
+		lines = lines[len(lines)-anchorLines:]
+	}
+
+	return bytes.Join(lines, nil)
+}
+
+// logsSinceLastSend returns logs after the last occurrence of anchor of
+// previous send, whole logs are returned if anchor is not found.
+func logsSinceLastSend(pod *v1.Pod, containerName string, logs *bytes.Buffer) *bytes.Buffer {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	anchorsMu.Lock()
+	var anchor []byte
+	if a, ok := anchors[key]; ok && a.uid == pod.GetUID() {
+		anchor = a.anchors[containerName]
+	}
+	anchorsMu.Unlock()
+
+	if len(anchor) == 0 {
+		return logs
+	}
+
+	i := bytes.LastIndex(logs.Bytes(), anchor)
+	if i < 0 {
+		return logs
+	}
+
+	klog.V(4).Infof("Container %s logs are already sent up to %d bytes", containerName, i+len(anchor))
+
+	return bytes.NewBuffer(logs.Bytes()[i+len(anchor):])
+}
+
+// rememberLogAnchor saves anchor of sent logs of container.
+func rememberLogAnchor(pod *v1.Pod, containerName string, anchor []byte) {
+	if len(anchor) == 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	anchorsMu.Lock()
+	defer anchorsMu.Unlock()
+
+	a, ok := anchors[key]
+	if !ok || a.uid != pod.GetUID() {
+		a = &podAnchors{uid: pod.GetUID(), anchors: map[string][]byte{}}
+		anchors[key] = a
+	}
+	a.anchors[containerName] = anchor
+}
+
+// forgetLogAnchors removes deleted pod from sent anchors.
+func forgetLogAnchors(key string) {
+	anchorsMu.Lock()
+	delete(anchors, key)
+	anchorsMu.Unlock()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// maxDigestBytes caps digest if --max-bytes is not set, oldest logs are
+// dropped when digest grows over the cap
+const maxDigestBytes = 10 << 20
+
+var (
+	digestMu sync.Mutex
+	// digestLogs holds logs accumulated since last digest
+	digestLogs  = new(bytes.Buffer)
+	digestCount int
+)
+
+// addToDigest appends container logs with caption to digest instead of
+// sending them.
+func addToDigest(pod *v1.Pod, caption string, logs *bytes.Buffer) {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	fmt.Fprintf(digestLogs, "===== %s/%s =====\n", pod.GetNamespace(), pod.GetName())
+	if len(caption) > 0 {
+		fmt.Fprintf(digestLogs, "%s\n\n", caption)
+	}
+	digestLogs.Write(logs.Bytes())
+	if !bytes.HasSuffix(digestLogs.Bytes(), []byte("\n")) {
+		digestLogs.WriteByte('\n')
+	}
+	digestCount++
+
+	capDigest()
+}
+
+// capDigest drops oldest lines of digest over --max-bytes or
+// maxDigestBytes, only the last bytes are sent anyway. It must be called
+// with digestMu held.
+func capDigest() {
+	limit := maxBytes
+	if limit <= 0 {
+		limit = maxDigestBytes
+	}
+
+	if digestLogs.Len() > limit {
+		digestLogs = bytes.NewBuffer(append([]byte(nil), truncateLogs(digestLogs, limit).Bytes()...))
+	}
+}
+
+// flushDigest sends logs accumulated since last digest as single document
+// to global destination, routes are not applied to digest.
+func flushDigest(ctx context.Context) {
+	digestMu.Lock()
+	logs, count := digestLogs, digestCount
+	digestLogs, digestCount = new(bytes.Buffer), 0
+	digestMu.Unlock()
+
+	if count == 0 {
+		return
+	}
+
+	klog.Infof("Send digest of %d logs", count)
+
+	// notifier may consume buffer, so logs are kept for requeue
+	data := logs.Bytes()
+
+	// failed digest is requeued, so it is not written to dead letter dir
+	err := sendNotification(withFinalAttempt(ctx, false), &notification{
+		name:    "digest",
+		caption: fmt.Sprintf("digest of %d logs since %s", count, time.Now().Add(-digestInterval).Format(time.RFC3339)),
+		logs:    truncateLogs(logs, maxBytes),
+	})
+	if err != nil {
+		klog.Errorf("[flushDigest] failed send digest, logs are requeued to next digest: %s", err)
+		recordSendError(nil, err)
+		requeueDigest(data, count)
+	}
+}
+
+// requeueDigest puts logs of failed digest before logs accumulated since
+// it, so they are sent with next digest.
+func requeueDigest(data []byte, count int) {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	requeued := bytes.NewBuffer(append([]byte(nil), data...))
+	requeued.Write(digestLogs.Bytes())
+	digestLogs = requeued
+	digestCount += count
+
+	capDigest()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func resetDigest() {
+	digestMu.Lock()
+	digestLogs, digestCount = new(bytes.Buffer), 0
+	digestMu.Unlock()
+}
+
+func TestAddToDigestCap(t *testing.T) {
+	savedMaxBytes := maxBytes
+	defer func() {
+		maxBytes = savedMaxBytes
+		resetDigest()
+	}()
+	resetDigest()
+	maxBytes = 100
+
+	pod := newTestPod("default", "digest-cap")
+	for i := 0; i < 50; i++ {
+		addToDigest(pod, "", bytes.NewBufferString("line of container logs\n"))
+	}
+
+	if digestLogs.Len() > maxBytes {
+		t.Errorf("digest is %d bytes, more than %d", digestLogs.Len(), maxBytes)
+	}
+	if !strings.HasSuffix(digestLogs.String(), "line of container logs\n") {
+		t.Errorf("digest = %q, want last logs kept", digestLogs.String())
+	}
+	if digestCount != 50 {
+		t.Errorf("digest count = %d, want 50", digestCount)
+	}
+}
+
+func TestFlushDigestRequeue(t *testing.T) {
+	recorder, restore := setupTest(t)
+	defer restore()
+	defer resetDigest()
+	resetDigest()
+
+	pod := newTestPod("default", "digest-requeue")
+	addToDigest(pod, "", bytes.NewBufferString("first\n"))
+
+	recorder.err = errors.New("unavailable")
+	flushDigest(context.Background())
+
+	addToDigest(pod, "", bytes.NewBufferString("second\n"))
+
+	recorder.err = nil
+	flushDigest(context.Background())
+
+	if len(recorder.logs) != 1 {
+		t.Fatalf("sent digests = %d, want 1", len(recorder.logs))
+	}
+	got := recorder.logs[0]
+	if first, second := strings.Index(got, "first"), strings.Index(got, "second"); first < 0 || second < first {
+		t.Errorf("digest = %q, want failed logs before new logs", got)
+	}
+	if digestCount != 0 {
+		t.Errorf("digest count = %d after flush, want 0", digestCount)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// discord rejects attachments larger than 8MB
+	discordMaxFileBytes = 8*1024*1024 - 1024
+	// discord rejects message content longer than 2000 characters
+	discordMaxContentLen = 2000
+)
+
+type discordNotifier struct {
+	webhookURL string
+}
+
+type discordPayload struct {
+	Content string `json:"content"`
+}
+
+func (d *discordNotifier) LogFormat() logFormat {
+	return logFormatRaw
+}
+
+func (d *discordNotifier) SendLogs(ctx context.Context, n *notification) error {
+	payload, err := json.Marshal(discordPayload{Content: truncateText(n.caption, discordMaxContentLen)})
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendLogs] failed marshal payload: %s", err)
+	}
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+
+	err = mw.WriteField("payload_json", string(payload))
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendLogs] failed write payload: %s", err)
+	}
+
+	fw, err := mw.CreateFormFile("file", n.fileName())
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendLogs] failed create form file: %s", err)
+	}
+
+	_, err = fw.Write(truncateLogs(n.logs, discordMaxFileBytes).Bytes())
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendLogs] failed write logs: %s", err)
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendLogs] failed close multipart writer: %s", err)
+	}
+
+	return d.post(ctx, mw.FormDataContentType(), body)
+}
+
+func (d *discordNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	payload, err := json.Marshal(discordPayload{Content: truncateText(text, discordMaxContentLen)})
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.SendMessage] failed marshal payload: %s", err)
+	}
+
+	return d.post(ctx, "application/json", bytes.NewBuffer(payload))
+}
+
+func (d *discordNotifier) post(ctx context.Context, contentType string, body *bytes.Buffer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhookURL, body)
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.post] failed create request: %s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := (&http.Client{Transport: notifierTransport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("[discordNotifier.post] failed send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("[discordNotifier.post] unexpected response %s: %s", resp.Status, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// maxEventMessageLen limits length of event message in summary
+const maxEventMessageLen = 120
+
+// getPodEvents returns events of pod.
+func getPodEvents(ctx context.Context, pod *v1.Pod) ([]v1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Pod",
+		"involvedObject.name": pod.GetName(),
+		"involvedObject.uid":  string(pod.GetUID()),
+	}.AsSelector().String()
+
+	events, err := clientset.CoreV1().Events(pod.GetNamespace()).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("[getPodEvents] failed list events: %s", err)
+	}
+
+	return events.Items, nil
+}
+
+// eventTime returns time of the last event occurrence.
+func eventTime(event v1.Event) metav1.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp
+	}
+
+	if !event.EventTime.IsZero() {
+		return metav1.Time{Time: event.EventTime.Time}
+	}
+
+	return event.FirstTimestamp
+}
+
+// eventsSummary returns short summary of last limit pod events.
+func eventsSummary(ctx context.Context, pod *v1.Pod, limit int) (string, error) {
+	events, err := getPodEvents(ctx, pod)
+	if err != nil {
+		return "", fmt.Errorf("[eventsSummary] failed get pod events: %s", err)
+	}
+
+	if len(events) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		ti, tj := eventTime(events[i]), eventTime(events[j])
+		return ti.Before(&tj)
+	})
+
+	if len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+
+	var b strings.Builder
+	b.WriteString("events:\n")
+	for _, event := range events {
+		message := truncateText(redactText(strings.TrimSpace(event.Message)), maxEventMessageLen)
+		fmt.Fprintf(&b, "%s %s: %s\n", event.Type, event.Reason, message)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var (
+	// logFetches limits concurrent log streams, nil means no limit
+	logFetches chan struct{}
+	// logFetchesInFlight is number of log streams in progress
+	logFetchesInFlight int64
+)
+
+// acquireLogFetch waits for free slot of --max-concurrent-log-fetches and
+// returns function which frees it.
+func acquireLogFetch(ctx context.Context) (func(), error) {
+	if logFetches != nil {
+		select {
+		case logFetches <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	atomic.AddInt64(&logFetchesInFlight, 1)
+
+	return func() {
+		atomic.AddInt64(&logFetchesInFlight, -1)
+		if logFetches != nil {
+			<-logFetches
+		}
+	}, nil
+}
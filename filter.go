@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var logGroupSeparator = []byte("--\n")
+
+// splitLogLines splits logs by lines, every line keeps its trailing newline.
+func splitLogLines(logs []byte) [][]byte {
+	lines := bytes.SplitAfter(logs, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// grepLogLines returns lines matched by pattern together with context
+// surrounding lines. Non adjacent groups of lines are separated by "--"
+// like grep does.
+func grepLogLines(logs *bytes.Buffer, pattern *regexp.Regexp, context int) *bytes.Buffer {
+	lines := splitLogLines(logs.Bytes())
+
+	selected := make([]bool, len(lines))
+	for i, line := range lines {
+		if !pattern.Match(line) {
+			continue
+		}
+
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(lines) {
+				selected[j] = true
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	last := -1
+	for i, line := range lines {
+		if !selected[i] {
+			continue
+		}
+
+		if context > 0 && last >= 0 && i-last > 1 {
+			buf.Write(logGroupSeparator)
+		}
+		buf.Write(line)
+		last = i
+	}
+
+	return buf
+}
+
+// excludeLogLines drops lines matched by pattern.
+func excludeLogLines(logs *bytes.Buffer, pattern *regexp.Regexp) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	for _, line := range splitLogLines(logs.Bytes()) {
+		if !pattern.Match(line) {
+			buf.Write(line)
+		}
+	}
+
+	return buf
+}
+
+// parseLogLevels returns rank of every level from ordered list, aliases of
+// the same level are separated by "|", e.g. WARN|WARNING.
+func parseLogLevels(list []string) map[string]int {
+	ranks := map[string]int{}
+	for i, level := range list {
+		for _, alias := range strings.Split(level, "|") {
+			ranks[strings.ToUpper(alias)] = i
+		}
+	}
+
+	return ranks
+}
+
+// minLevelRank returns rank of --log-min-level.
+func minLevelRank(ranks map[string]int, level string) (int, error) {
+	rank, ok := ranks[strings.ToUpper(level)]
+	if !ok {
+		return 0, fmt.Errorf("[minLevelRank] unknown log level %q", level)
+	}
+
+	return rank, nil
+}
+
+// levelLogLines drops lines which level is lower than min rank. Level is
+// the first group of pattern match, lines without level follow decision
+// of previous line, so multiline stack traces are kept together.
+func levelLogLines(logs *bytes.Buffer, pattern *regexp.Regexp, ranks map[string]int, min int) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	keep := true
+
+	for _, line := range splitLogLines(logs.Bytes()) {
+		if m := pattern.FindSubmatch(line); len(m) > 1 {
+			if rank, ok := ranks[strings.ToUpper(string(m[1]))]; ok {
+				keep = rank >= min
+			}
+		}
+
+		if keep {
+			buf.Write(line)
+		}
+	}
+
+	return buf
+}
+
+// filterLogLines applies log grep, log exclude patterns and then min log
+// level to logs.
+func filterLogLines(logs *bytes.Buffer) *bytes.Buffer {
+	if logGrepRegexp != nil {
+		logs = grepLogLines(logs, logGrepRegexp, logGrepContext)
+	}
+
+	if logExcludeRegexp != nil {
+		logs = excludeLogLines(logs, logExcludeRegexp)
+	}
+
+	if logLevelRegexp != nil {
+		logs = levelLogLines(logs, logLevelRegexp, logLevelRanks, logMinLevelRank)
+	}
+
+	return logs
+}
+
+func isLogFilterEnabled() bool {
+	return logGrepRegexp != nil || logExcludeRegexp != nil || logLevelRegexp != nil
+}
+
+// truncateLogs keeps last max bytes of logs cut by line boundary,
+// max less or equal zero means no limit.
+func truncateLogs(logs *bytes.Buffer, max int) *bytes.Buffer {
+	if max <= 0 || logs.Len() <= max {
+		return logs
+	}
+
+	tail := logs.Bytes()[logs.Len()-max:]
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+
+	return bytes.NewBuffer(tail)
+}
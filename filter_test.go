@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestFilterLogLines(t *testing.T) {
+	logs := "start\n" +
+		"request id=1\n" +
+		"ERROR db timeout\n" +
+		"retry id=1\n" +
+		"request id=2\n" +
+		"request id=3\n" +
+		"ERROR healthcheck failed\n" +
+		"shutdown"
+
+	tests := []struct {
+		name    string
+		grep    string
+		context int
+		exclude string
+		want    string
+	}{
+		{
+			name: "no filters",
+			want: logs,
+		},
+		{
+			name: "grep",
+			grep: "ERROR",
+			want: "ERROR db timeout\nERROR healthcheck failed\n",
+		},
+		{
+			name:    "grep with context",
+			grep:    "ERROR",
+			context: 1,
+			want: "request id=1\nERROR db timeout\nretry id=1\n" +
+				"--\n" +
+				"request id=3\nERROR healthcheck failed\nshutdown",
+		},
+		{
+			name:    "exclude",
+			exclude: "^request ",
+			want:    "start\nERROR db timeout\nretry id=1\nERROR healthcheck failed\nshutdown",
+		},
+		{
+			name:    "exclude applied after grep",
+			grep:    "ERROR",
+			exclude: "healthcheck",
+			want:    "ERROR db timeout\n",
+		},
+		{
+			name:    "exclude drops context lines",
+			grep:    "ERROR",
+			context: 1,
+			exclude: "id=",
+			want:    "ERROR db timeout\n--\nERROR healthcheck failed\nshutdown",
+		},
+		{
+			name:    "exclude matches grep line",
+			grep:    "timeout",
+			exclude: "ERROR",
+			want:    "",
+		},
+		{
+			name: "grep matches nothing",
+			grep: "panic",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedGrep, savedContext, savedExclude := logGrepRegexp, logGrepContext, logExcludeRegexp
+			defer func() {
+				logGrepRegexp, logGrepContext, logExcludeRegexp = savedGrep, savedContext, savedExclude
+			}()
+
+			logGrepRegexp, logExcludeRegexp = nil, nil
+			if len(tt.grep) > 0 {
+				logGrepRegexp = regexp.MustCompile(tt.grep)
+			}
+			logGrepContext = tt.context
+			if len(tt.exclude) > 0 {
+				logExcludeRegexp = regexp.MustCompile(tt.exclude)
+			}
+
+			got := filterLogLines(bytes.NewBufferString(logs)).String()
+			if got != tt.want {
+				t.Errorf("filterLogLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
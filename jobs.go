@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var (
+	failedJobsMu sync.Mutex
+	// failedJobs holds uid of failed jobs already notified
+	failedJobs = map[types.UID]bool{}
+)
+
+// newJobInformer returns informer of jobs from controller factory which
+// sends logs of last failed pod of every failed job.
+func newJobInformer(c *Controller) cache.Controller {
+	informer := c.factory.Batch().V1().Jobs().Informer()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if job, ok := obj.(*batchv1.Job); ok {
+				go c.processJob(c.ctx, job)
+			}
+		},
+		UpdateFunc: func(old interface{}, new interface{}) {
+			if job, ok := new.(*batchv1.Job); ok {
+				go c.processJob(c.ctx, job)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if job, ok := obj.(*batchv1.Job); ok {
+				releaseJob(job)
+			}
+		},
+	})
+
+	return informer
+}
+
+// isJobFailed reports whether job has Failed condition or its failed pods
+// exceeded backoff limit.
+func isJobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+
+	// backoff limit defaults to 6
+	backoffLimit := int32(6)
+	if job.Spec.BackoffLimit != nil {
+		backoffLimit = *job.Spec.BackoffLimit
+	}
+
+	return job.Status.Failed > backoffLimit
+}
+
+// jobFailedAt returns transition time of Failed condition of job, failure
+// time of last failed pod is used for job failed without condition.
+func jobFailedAt(job *batchv1.Job, pod *v1.Pod) time.Time {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+
+	if pod != nil {
+		return podFailedAt(pod)
+	}
+
+	return time.Time{}
+}
+
+// lastFailedPod returns the most recently created failed pod of job or nil.
+func lastFailedPod(ctx context.Context, job *batchv1.Job) (*v1.Pod, error) {
+	if job.Spec.Selector == nil {
+		return nil, nil
+	}
+
+	pods, err := clientset.CoreV1().Pods(job.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(job.Spec.Selector),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[lastFailedPod] failed list pods of job %s: %s", job.GetName(), err)
+	}
+
+	var last *v1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != v1.PodFailed {
+			continue
+		}
+
+		if last == nil || last.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			last = pod
+		}
+	}
+
+	return last, nil
+}
+
+// jobPod returns placeholder pod of job, so failure of job without failed
+// pod is routed by job namespace.
+func jobPod(job *batchv1.Job) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: job.GetNamespace(),
+		Name:      job.GetName(),
+	}}
+}
+
+// processJob sends failure of job and logs of its last failed pod once for
+// every failed job. Job is claimed before send, so concurrent events don't
+// send it twice, and released if send failed, so next event retries it.
+func (c *Controller) processJob(ctx context.Context, job *batchv1.Job) {
+	if !isJobFailed(job) {
+		return
+	}
+
+	// with --namespace-selector jobs of all namespaces are watched
+	if c.indexerFor(job.GetNamespace()) == nil || isNamespaceExcluded(job.GetNamespace()) {
+		return
+	}
+
+	failedJobsMu.Lock()
+	if failedJobs[job.GetUID()] {
+		failedJobsMu.Unlock()
+		return
+	}
+	failedJobs[job.GetUID()] = true
+	failedJobsMu.Unlock()
+
+	pod, err := lastFailedPod(ctx, job)
+	if err != nil {
+		klog.Errorf("[processJob] %s", err)
+	}
+
+	// jobs failed before restart are listed by informer again
+	if !isFailureRecent(fmt.Sprintf("job %s/%s", job.GetNamespace(), job.GetName()), jobFailedAt(job, pod)) {
+		return
+	}
+
+	klog.Infof("Send failure of job: %s, failed pods: %d", job.GetName(), job.Status.Failed)
+
+	messagePod := pod
+	if messagePod == nil {
+		messagePod = jobPod(job)
+	}
+
+	err = sendMessage(ctx, messagePod, fmt.Sprintf("job %s/%s failed, failed pods: %d", job.GetNamespace(), job.GetName(), job.Status.Failed))
+	if err != nil {
+		klog.Errorf("[processJob] failed send job failure: %s", err)
+		recordSendError(messagePod, err)
+		releaseJob(job)
+		return
+	}
+
+	if pod == nil {
+		return
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if !isContainerMatched(pod, containerStatus) {
+			continue
+		}
+
+		// logs may be already sent on container termination
+		if containerStatus.State.Terminated != nil && !claimTermination(pod, containerStatus) {
+			continue
+		}
+
+		err = sendContainerLogs(ctx, pod, containerStatus.Name, false)
+		if err != nil {
+			klog.Errorf("[processJob] failed send container logs: %s", err)
+			recordSendError(pod, err)
+		}
+	}
+}
+
+// releaseJob forgets failed job, so its failure is sent again.
+func releaseJob(job *batchv1.Job) {
+	failedJobsMu.Lock()
+	delete(failedJobs, job.GetUID())
+	failedJobsMu.Unlock()
+}
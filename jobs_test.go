@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func failedTestJob(name string, ago time.Duration) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       types.UID(name + "-uid"),
+		},
+		Status: batchv1.JobStatus{
+			Failed: 1,
+			Conditions: []batchv1.JobCondition{{
+				Type:               batchv1.JobFailed,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-ago)),
+			}},
+		},
+	}
+}
+
+func TestProcessJob(t *testing.T) {
+	tests := []struct {
+		name string
+		job  *batchv1.Job
+		want int
+	}{
+		{name: "failed within delay", job: failedTestJob("job-failed-recently", time.Second), want: 1},
+		{name: "failed out of delay", job: failedTestJob("job-failed-long-ago", time.Hour)},
+		{
+			name: "not failed",
+			job: &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "job-running",
+				UID:       "job-running-uid",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, restore := setupTest(t, tt.job)
+			defer restore()
+
+			queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer queue.ShutDown()
+
+			c := NewController(queue, nil)
+			factory, informer := newPodInformer(metav1.NamespaceAll, queue, func(error) {})
+			c.podInformers[metav1.NamespaceAll] = &podInformer{factory: factory, informer: informer}
+
+			c.processJob(context.Background(), tt.job)
+			c.processJob(context.Background(), tt.job)
+
+			if len(recorder.messages) != tt.want {
+				t.Errorf("sent messages = %d, want %d", len(recorder.messages), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessJobRetriesFailedSend(t *testing.T) {
+	job := failedTestJob("job-failed-send", time.Second)
+	job.Namespace = "team"
+
+	recorder, restore := setupTest(t, job)
+	defer restore()
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	c := NewController(queue, nil)
+	factory, informer := newPodInformer(metav1.NamespaceAll, queue, func(error) {})
+	c.podInformers[metav1.NamespaceAll] = &podInformer{factory: factory, informer: informer}
+
+	recorder.err = context.DeadlineExceeded
+	c.processJob(context.Background(), job)
+
+	recorder.err = nil
+	c.processJob(context.Background(), job)
+
+	if len(recorder.messages) != 1 {
+		t.Fatalf("sent messages = %d, want 1 after retry", len(recorder.messages))
+	}
+
+	// job without failed pods is routed by its namespace
+	if pod := recorder.messagePods[0]; pod == nil || pod.GetNamespace() != "team" {
+		t.Errorf("message pod = %v, want pod in namespace team", pod)
+	}
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// brokers reject messages larger than message.max.bytes, 1MB by default
+	kafkaMaxValueBytes = 900 * 1024
+	// timeout of broker request if context has no deadline
+	kafkaRequestTimeout = 30 * time.Second
+	// topic metadata is refreshed after this time or failed produce
+	kafkaMetadataTTL = 5 * time.Minute
+
+	kafkaProduceKey      = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadataKey     = 3
+	kafkaMetadataVersion = 4
+	kafkaClientID        = "logs-sender"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaNotifier publishes logs to kafka topic, it speaks kafka protocol
+// itself, brokers 0.11 or newer without SASL are supported. Connections
+// to brokers and topic metadata are reused.
+type kafkaNotifier struct {
+	brokers []string
+	topic   string
+	tls     bool
+
+	mu    sync.Mutex
+	conns map[string]*kafkaConn
+
+	metadataMu sync.Mutex
+	metadata   kafkaTopicMetadata
+	metadataAt time.Time
+}
+
+// kafkaConn is connection to broker, requests to the same broker are
+// serialized.
+type kafkaConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+type kafkaHeader struct {
+	key   string
+	value string
+}
+
+// kafkaHeaders returns pod and container metadata as record headers.
+func kafkaHeaders(kind string, pod *v1.Pod, containerName string, reason string) []kafkaHeader {
+	headers := []kafkaHeader{{key: "type", value: kind}}
+	if pod != nil {
+		headers = append(headers,
+			kafkaHeader{key: "namespace", value: pod.GetNamespace()},
+			kafkaHeader{key: "pod", value: pod.GetName()},
+			kafkaHeader{key: "pod-uid", value: string(pod.GetUID())},
+		)
+	}
+	if len(containerName) > 0 {
+		headers = append(headers, kafkaHeader{key: "container", value: containerName})
+	}
+	if len(reason) > 0 {
+		headers = append(headers, kafkaHeader{key: "reason", value: reason})
+	}
+
+	return headers
+}
+
+// kafkaKey returns record key, records of the same pod go to the same
+// partition.
+func kafkaKey(pod *v1.Pod) []byte {
+	if pod == nil {
+		return nil
+	}
+
+	return []byte(fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName()))
+}
+
+// LogFormat returns json format, record value is json envelope of logs
+// and metadata, metadata is duplicated in headers for routing.
+func (k *kafkaNotifier) LogFormat() logFormat {
+	return logFormatJSON
+}
+
+// MaxLogBytes leaves room for json escaping of logs in record value.
+func (k *kafkaNotifier) MaxLogBytes() int {
+	return kafkaMaxValueBytes * 8 / 10
+}
+
+func (k *kafkaNotifier) SendLogs(ctx context.Context, n *notification) error {
+	return k.produce(ctx, kafkaKey(n.pod), n.logs.Bytes(), kafkaHeaders("logs", n.pod, n.containerName, n.reason))
+}
+
+func (k *kafkaNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	return k.produce(ctx, kafkaKey(pod), []byte(truncateTextBytes(text, kafkaMaxValueBytes)), kafkaHeaders("message", pod, "", ""))
+}
+
+// truncateTextBytes cuts text to max bytes by rune boundary.
+func truncateTextBytes(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	return text[:cut]
+}
+
+// produce sends record to leader of partition chosen by key, metadata is
+// refreshed after failed send, leader of partition may be changed.
+func (k *kafkaNotifier) produce(ctx context.Context, key []byte, value []byte, headers []kafkaHeader) error {
+	metadata, err := k.cachedMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	partition, leader, err := metadata.partitionFor(key)
+	if err != nil {
+		return fmt.Errorf("[kafkaNotifier.produce] %s", err)
+	}
+
+	req := kafkaProduceRequest{
+		acks:      -1, // acks from all in-sync replicas
+		timeout:   kafkaRequestTimeout,
+		topic:     k.topic,
+		partition: partition,
+		records:   newKafkaBatch(key, value, headers).encode(),
+	}
+
+	resp, err := k.request(ctx, leader, kafkaProduceKey, kafkaProduceVersion, req.encode())
+	if err != nil {
+		k.forgetMetadata()
+		return fmt.Errorf("[kafkaNotifier.produce] failed send record: %s", err)
+	}
+
+	err = decodeKafkaProduceResponse(resp)
+	if err != nil {
+		k.forgetMetadata()
+		return fmt.Errorf("[kafkaNotifier.produce] %s", err)
+	}
+
+	return nil
+}
+
+// cachedMetadata returns metadata of topic, it is requested from brokers
+// if cached metadata is older than kafkaMetadataTTL or forgotten.
+func (k *kafkaNotifier) cachedMetadata(ctx context.Context) (kafkaTopicMetadata, error) {
+	k.metadataMu.Lock()
+	defer k.metadataMu.Unlock()
+
+	if !k.metadataAt.IsZero() && time.Since(k.metadataAt) < kafkaMetadataTTL {
+		return k.metadata, nil
+	}
+
+	metadata, err := k.topicMetadata(ctx)
+	if err != nil {
+		return kafkaTopicMetadata{}, err
+	}
+	k.metadata, k.metadataAt = metadata, time.Now()
+
+	return metadata, nil
+}
+
+// forgetMetadata makes next produce request metadata from brokers.
+func (k *kafkaNotifier) forgetMetadata() {
+	k.metadataMu.Lock()
+	k.metadataAt = time.Time{}
+	k.metadataMu.Unlock()
+}
+
+// topicMetadata returns partitions of topic and their leaders, brokers
+// are asked in order until one responds.
+func (k *kafkaNotifier) topicMetadata(ctx context.Context) (kafkaTopicMetadata, error) {
+	req := new(kafkaEncoder)
+	req.int32(1)
+	req.string(k.topic)
+	req.int8(0) // don't create topic
+
+	var err error
+	for _, broker := range k.brokers {
+		var resp []byte
+		resp, err = k.request(ctx, broker, kafkaMetadataKey, kafkaMetadataVersion, req.Bytes())
+		if err != nil {
+			continue
+		}
+
+		var metadata kafkaTopicMetadata
+		metadata, err = decodeKafkaMetadata(resp, k.topic)
+		if err == nil {
+			return metadata, nil
+		}
+	}
+
+	return kafkaTopicMetadata{}, fmt.Errorf("[kafkaNotifier.topicMetadata] failed get metadata of topic %s: %s", k.topic, err)
+}
+
+// kafkaTopicMetadata holds all partitions of topic and addresses of
+// leaders of partitions which have leader.
+type kafkaTopicMetadata struct {
+	partitions []int32
+	leaders    map[int32]string
+}
+
+// partitionFor returns partition chosen by key hash over all topic
+// partitions and its leader, so key is mapped to the same partition while
+// some partition is offline.
+func (m kafkaTopicMetadata) partitionFor(key []byte) (int32, string, error) {
+	if len(m.partitions) == 0 {
+		return 0, "", fmt.Errorf("[kafkaTopicMetadata.partitionFor] topic has no partitions")
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	partition := m.partitions[h.Sum32()%uint32(len(m.partitions))]
+
+	leader, ok := m.leaders[partition]
+	if !ok {
+		return 0, "", fmt.Errorf("[kafkaTopicMetadata.partitionFor] partition %d has no leader", partition)
+	}
+
+	return partition, leader, nil
+}
+
+// decodeKafkaMetadata returns partitions of topic and their leaders from
+// metadata response v4.
+func decodeKafkaMetadata(resp []byte, topic string) (kafkaTopicMetadata, error) {
+	d := &kafkaDecoder{b: resp}
+	d.int32() // throttle time
+
+	brokers := map[int32]string{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster id
+	d.int32()  // controller id
+
+	metadata := kafkaTopicMetadata{leaders: map[int32]string{}}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int16()
+			partition := d.int32()
+			leader := d.int32()
+			for replicas := d.int32(); replicas > 0 && d.err == nil; replicas-- {
+				d.int32()
+			}
+			for isr := d.int32(); isr > 0 && d.err == nil; isr-- {
+				d.int32()
+			}
+			if name != topic {
+				continue
+			}
+			metadata.partitions = append(metadata.partitions, partition)
+			if addr, ok := brokers[leader]; ok {
+				metadata.leaders[partition] = addr
+			}
+		}
+		if name == topic && code != 0 {
+			return kafkaTopicMetadata{}, fmt.Errorf("[decodeKafkaMetadata] topic error code %d", code)
+		}
+	}
+	if d.err != nil {
+		return kafkaTopicMetadata{}, fmt.Errorf("[decodeKafkaMetadata] failed decode response: %s", d.err)
+	}
+
+	if len(metadata.partitions) == 0 {
+		return kafkaTopicMetadata{}, fmt.Errorf("[decodeKafkaMetadata] no partitions of topic %s", topic)
+	}
+	sort.Slice(metadata.partitions, func(i, j int) bool { return metadata.partitions[i] < metadata.partitions[j] })
+
+	return metadata, nil
+}
+
+// kafkaProduceRequest is produce request v3 with records of single
+// partition.
+type kafkaProduceRequest struct {
+	acks      int16
+	timeout   time.Duration
+	topic     string
+	partition int32
+	records   []byte
+}
+
+func (r kafkaProduceRequest) encode() []byte {
+	req := new(kafkaEncoder)
+	req.int16(-1) // transactional id
+	req.int16(r.acks)
+	req.int32(int32(r.timeout / time.Millisecond))
+	req.int32(1)
+	req.string(r.topic)
+	req.int32(1)
+	req.int32(r.partition)
+	req.bytes(r.records)
+
+	return req.Bytes()
+}
+
+// decodeKafkaProduceResponse returns error of first partition rejected
+// records in produce response v3.
+func decodeKafkaProduceResponse(resp []byte) error {
+	d := &kafkaDecoder{b: resp}
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		d.string()
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // offset
+			d.int64() // log append time
+			if code != 0 && d.err == nil {
+				return fmt.Errorf("[decodeKafkaProduceResponse] broker rejected record of partition %d with error code %d", partition, code)
+			}
+		}
+	}
+	d.int32() // throttle time
+	if d.err != nil {
+		return fmt.Errorf("[decodeKafkaProduceResponse] failed decode response: %s", d.err)
+	}
+
+	return nil
+}
+
+// kafkaBatch is record batch of magic v2 with single record, timestamps
+// are in milliseconds.
+type kafkaBatch struct {
+	lastOffsetDelta int32
+	firstTimestamp  int64
+	maxTimestamp    int64
+	producerID      int64
+	producerEpoch   int16
+	baseSequence    int32
+	timestampDelta  int64
+	key             []byte
+	value           []byte
+	headers         []kafkaHeader
+}
+
+// newKafkaBatch returns batch of record created now by producer without
+// idempotence.
+func newKafkaBatch(key []byte, value []byte, headers []kafkaHeader) kafkaBatch {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	return kafkaBatch{
+		firstTimestamp: now,
+		maxTimestamp:   now,
+		producerID:     -1,
+		producerEpoch:  -1,
+		baseSequence:   -1,
+		key:            key,
+		value:          value,
+		headers:        headers,
+	}
+}
+
+func (b kafkaBatch) encode() []byte {
+	record := new(kafkaEncoder)
+	record.int8(0) // attributes
+	record.varint(b.timestampDelta)
+	record.varint(0) // offset delta
+	record.varbytes(b.key)
+	record.varbytes(b.value)
+	record.varint(int64(len(b.headers)))
+	for _, header := range b.headers {
+		record.varbytes([]byte(header.key))
+		record.varbytes([]byte(header.value))
+	}
+
+	// part of batch covered by crc
+	body := new(kafkaEncoder)
+	body.int16(0) // attributes, no compression
+	body.int32(b.lastOffsetDelta)
+	body.int64(b.firstTimestamp)
+	body.int64(b.maxTimestamp)
+	body.int64(b.producerID)
+	body.int16(b.producerEpoch)
+	body.int32(b.baseSequence)
+	body.int32(1)
+	body.varint(int64(record.Len()))
+	body.Write(record.Bytes())
+
+	batch := new(kafkaEncoder)
+	batch.int64(0) // base offset
+	// length of batch after this field
+	batch.int32(int32(4 + 1 + 4 + body.Len()))
+	batch.int32(0) // partition leader epoch
+	batch.int8(2)  // magic
+	batch.int32(int32(crc32.Checksum(body.Bytes(), crc32cTable)))
+	batch.Write(body.Bytes())
+
+	return batch.Bytes()
+}
+
+// request sends request to broker over reused connection, connection is
+// closed on any error and dialed again by next request.
+func (k *kafkaNotifier) request(ctx context.Context, addr string, apiKey int16, apiVersion int16, body []byte) ([]byte, error) {
+	k.mu.Lock()
+	if k.conns == nil {
+		k.conns = map[string]*kafkaConn{}
+	}
+	c, ok := k.conns[addr]
+	if !ok {
+		c = &kafkaConn{}
+		k.conns[addr] = c
+	}
+	k.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(kafkaRequestTimeout)
+	}
+
+	if c.conn == nil {
+		conn, err := k.dial(ctx, addr, deadline)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	resp, err := kafkaRoundTrip(c.conn, deadline, addr, apiKey, apiVersion, body)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// dial connects to broker, TLS is used if --kafka-tls is set.
+func (k *kafkaNotifier) dial(ctx context.Context, addr string, deadline time.Time) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("[kafkaNotifier.dial] failed connect broker %s: %s", addr, err)
+	}
+
+	if !k.tls {
+		return conn, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("[kafkaNotifier.dial] invalid broker address %s: %s", addr, err)
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	tlsConn.SetDeadline(deadline)
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("[kafkaNotifier.dial] failed tls handshake with broker %s: %s", addr, err)
+	}
+
+	return tlsConn, nil
+}
+
+var kafkaCorrelationID int32
+
+// kafkaRoundTrip writes request to connection and returns response body
+// without header.
+func kafkaRoundTrip(conn net.Conn, deadline time.Time, addr string, apiKey int16, apiVersion int16, body []byte) ([]byte, error) {
+	conn.SetDeadline(deadline)
+
+	correlationID := atomic.AddInt32(&kafkaCorrelationID, 1)
+
+	req := new(kafkaEncoder)
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(correlationID)
+	req.string(kafkaClientID)
+	req.Write(body)
+
+	frame := new(kafkaEncoder)
+	frame.bytes(req.Bytes())
+
+	_, err := conn.Write(frame.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("[kafkaRoundTrip] failed write request to broker %s: %s", addr, err)
+	}
+
+	var size int32
+	err = binary.Read(conn, binary.BigEndian, &size)
+	if err != nil {
+		return nil, fmt.Errorf("[kafkaRoundTrip] failed read response size from broker %s: %s", addr, err)
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("[kafkaRoundTrip] invalid response size %d from broker %s", size, addr)
+	}
+
+	resp := make([]byte, size)
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		return nil, fmt.Errorf("[kafkaRoundTrip] failed read response from broker %s: %s", addr, err)
+	}
+
+	if int32(binary.BigEndian.Uint32(resp)) != correlationID {
+		return nil, fmt.Errorf("[kafkaRoundTrip] unexpected correlation id from broker %s", addr)
+	}
+
+	return resp[4:], nil
+}
+
+// kafkaEncoder writes kafka protocol primitives in big endian.
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+// varint writes zigzag encoded variable length integer.
+func (e *kafkaEncoder) varint(v int64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	e.Write(buf[:binary.PutVarint(buf, v)])
+}
+
+// varbytes writes bytes prefixed by varint length, nil is written as null.
+func (e *kafkaEncoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+
+	e.varint(int64(len(b)))
+	e.Write(b)
+}
+
+var errKafkaShortResponse = errors.New("short response")
+
+// kafkaDecoder reads kafka protocol primitives, first error is kept and
+// following reads return zero values.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(d.b) < n {
+		d.err = errKafkaShortResponse
+		return nil
+	}
+
+	b := d.b[:n]
+	d.b = d.b[n:]
+
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+
+	return 0
+}
+
+// string reads nullable string, null is returned as empty string.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+
+	return string(d.next(int(n)))
+}
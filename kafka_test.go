@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// produceRequestOneRecord is produce request v3 from sarama tests.
+var produceRequestOneRecord = []byte{
+	0xFF, 0xFF, // transactional id
+	0x01, 0x23, // acks
+	0x00, 0x00, 0x04, 0x44, // timeout
+	0x00, 0x00, 0x00, 0x01, // topics
+	0x00, 0x05, 't', 'o', 'p', 'i', 'c',
+	0x00, 0x00, 0x00, 0x01, // partitions
+	0x00, 0x00, 0x00, 0xAD, // partition
+	0x00, 0x00, 0x00, 0x52, // records length
+	// record batch
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // base offset
+	0x00, 0x00, 0x00, 0x46, // length
+	0x00, 0x00, 0x00, 0x00, // partition leader epoch
+	0x02,                   // magic
+	0xCA, 0x33, 0xBC, 0x05, // crc
+	0x00, 0x00, // attributes
+	0x00, 0x00, 0x00, 0x01, // last offset delta
+	0x00, 0x00, 0x01, 0x58, 0x8D, 0xCD, 0x59, 0x38, // first timestamp
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // max timestamp
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // producer id
+	0x00, 0x00, // producer epoch
+	0x00, 0x00, 0x00, 0x00, // base sequence
+	0x00, 0x00, 0x00, 0x01, // records
+	// record
+	0x28,                         // length
+	0x00,                         // attributes
+	0x0A,                         // timestamp delta
+	0x00,                         // offset delta
+	0x08, 0x01, 0x02, 0x03, 0x04, // key
+	0x06, 0x05, 0x06, 0x07, // value
+	0x02,                   // headers
+	0x06, 0x08, 0x09, 0x0A, // header key
+	0x04, 0x0B, 0x0C, // header value
+}
+
+// metadataOneTopicV4 is metadata response v4 from sarama tests, it is
+// OneTopicV6 without offline replicas.
+var metadataOneTopicV4 = []byte{
+	0x00, 0x00, 0x00, 0x07, // throttle time
+	0x00, 0x00, 0x00, 0x01, // brokers
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 'h', 'o', 's', 't', 0x00, 0x00, 0x23, 0x84, 0xff, 0xff,
+	0x00, 0x09, 'c', 'l', 'u', 's', 't', 'e', 'r', 'I', 'd',
+	0x00, 0x00, 0x00, 0x01, // controller id
+	0x00, 0x00, 0x00, 0x01, // topics
+	0x00, 0x00, 0x00, 0x04, 't', 'o', 'n', 'y', 0x00,
+	0x00, 0x00, 0x00, 0x01, // partitions
+	0x00, 0x00, // error code
+	0x00, 0x00, 0x00, 0x00, // partition
+	0x00, 0x00, 0x00, 0x00, // leader
+	0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, // replicas
+	0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, // isr
+}
+
+// produceResponseV3 is produce response v2 from sarama tests, v3 has the
+// same layout.
+var produceResponseV3 = []byte{
+	0x00, 0x00, 0x00, 0x01,
+	0x00, 0x03, 'f', 'o', 'o',
+	0x00, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x01, // partition
+	0x00, 0x02, // error code
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, // offset
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0xE8, // timestamp
+	0x00, 0x00, 0x00, 0x64, // throttle time
+}
+
+func TestKafkaProduceRequestEncode(t *testing.T) {
+	batch := kafkaBatch{
+		lastOffsetDelta: 1,
+		firstTimestamp:  1479847795000,
+		timestampDelta:  5,
+		key:             []byte{0x01, 0x02, 0x03, 0x04},
+		value:           []byte{0x05, 0x06, 0x07},
+		headers:         []kafkaHeader{{key: "\x08\x09\x0A", value: "\x0B\x0C"}},
+	}
+
+	req := kafkaProduceRequest{
+		acks:      0x123,
+		timeout:   0x444 * time.Millisecond,
+		topic:     "topic",
+		partition: 0xAD,
+		records:   batch.encode(),
+	}
+
+	if got := req.encode(); !bytes.Equal(got, produceRequestOneRecord) {
+		t.Errorf("encode() = % x, want % x", got, produceRequestOneRecord)
+	}
+}
+
+func TestDecodeKafkaMetadata(t *testing.T) {
+	metadata, err := decodeKafkaMetadata(metadataOneTopicV4, "tony")
+	if err != nil {
+		t.Fatalf("decodeKafkaMetadata() error = %v", err)
+	}
+
+	if len(metadata.partitions) != 1 || metadata.partitions[0] != 0 {
+		t.Errorf("partitions = %v, want [0]", metadata.partitions)
+	}
+	if metadata.leaders[0] != "host:9092" {
+		t.Errorf("leader of partition 0 = %q, want host:9092", metadata.leaders[0])
+	}
+
+	_, err = decodeKafkaMetadata(metadataOneTopicV4, "other")
+	if err == nil {
+		t.Error("decodeKafkaMetadata() of absent topic error = nil, want error")
+	}
+
+	_, err = decodeKafkaMetadata(metadataOneTopicV4[:len(metadataOneTopicV4)-1], "tony")
+	if err == nil {
+		t.Error("decodeKafkaMetadata() of short response error = nil, want error")
+	}
+}
+
+func TestDecodeKafkaProduceResponse(t *testing.T) {
+	err := decodeKafkaProduceResponse(produceResponseV3)
+	if err == nil || !strings.Contains(err.Error(), "error code 2") {
+		t.Errorf("decodeKafkaProduceResponse() error = %v, want error code 2", err)
+	}
+
+	ok := append([]byte{}, produceResponseV3...)
+	ok[18], ok[19] = 0, 0
+	if err := decodeKafkaProduceResponse(ok); err != nil {
+		t.Errorf("decodeKafkaProduceResponse() error = %v", err)
+	}
+}
+
+func TestKafkaPartitionFor(t *testing.T) {
+	metadata := kafkaTopicMetadata{
+		partitions: []int32{0, 1, 2},
+		leaders:    map[int32]string{0: "a:9092", 1: "b:9092", 2: "c:9092"},
+	}
+
+	key := []byte("default/app")
+	partition, leader, err := metadata.partitionFor(key)
+	if err != nil {
+		t.Fatalf("partitionFor() error = %v", err)
+	}
+	if leader != metadata.leaders[partition] {
+		t.Errorf("partitionFor() leader = %q, want leader of partition %d", leader, partition)
+	}
+
+	// key keeps partition while it is offline instead of moving to other one
+	delete(metadata.leaders, partition)
+	if _, _, err := metadata.partitionFor(key); err == nil {
+		t.Errorf("partitionFor() of partition without leader error = nil, want error")
+	}
+}
+
+// fakeKafkaBroker serves metadata and produce requests on single
+// connection and returns number of accepted connections, produced records
+// and number of metadata requests.
+func fakeKafkaBroker(l net.Listener, topic string) (<-chan int, <-chan []byte, *int32) {
+	host, portStr, _ := net.SplitHostPort(l.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	accepted := make(chan int, 1)
+	produced := make(chan []byte, 10)
+	metadataRequests := new(int32)
+
+	go func() {
+		conns := 0
+		defer func() { accepted <- conns }()
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns++
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					var size int32
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+					req := make([]byte, size)
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+
+					d := &kafkaDecoder{b: req}
+					apiKey := d.int16()
+					d.int16()
+					correlationID := d.int32()
+					d.string()
+
+					resp := new(kafkaEncoder)
+					resp.int32(correlationID)
+					switch apiKey {
+					case kafkaMetadataKey:
+						atomic.AddInt32(metadataRequests, 1)
+						resp.int32(0)
+						resp.int32(1)
+						resp.int32(1)
+						resp.string(host)
+						resp.int32(int32(port))
+						resp.int16(-1)
+						resp.string("cluster")
+						resp.int32(1)
+						resp.int32(1)
+						resp.int16(0)
+						resp.string(topic)
+						resp.int8(0)
+						resp.int32(1)
+						resp.int16(0)
+						resp.int32(0)
+						resp.int32(1)
+						resp.int32(0)
+						resp.int32(0)
+					case kafkaProduceKey:
+						produced <- d.b
+						resp.int32(0)
+						resp.int32(0)
+					}
+
+					frame := new(kafkaEncoder)
+					frame.bytes(resp.Bytes())
+					if _, err := conn.Write(frame.Bytes()); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return accepted, produced, metadataRequests
+}
+
+func TestKafkaNotifierReusesConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed listen: %v", err)
+	}
+
+	accepted, produced, metadataRequests := fakeKafkaBroker(l, "logs")
+	k := &kafkaNotifier{brokers: []string{l.Addr().String()}, topic: "logs"}
+
+	for i := 0; i < 2; i++ {
+		if err := k.SendMessage(context.Background(), nil, "message"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		req := <-produced
+		if !bytes.Contains(req, []byte("message")) {
+			t.Errorf("produce request %d doesn't contain message", i)
+		}
+	}
+
+	l.Close()
+	if conns := <-accepted; conns != 1 {
+		t.Errorf("broker accepted %d connections, want 1", conns)
+	}
+	if n := atomic.LoadInt32(metadataRequests); n != 1 {
+		t.Errorf("broker got %d metadata requests, want 1 cached for both sends", n)
+	}
+}
+
+func TestTruncateTextBytes(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{text: "short", max: 10, want: "short"},
+		{text: "abcdef", max: 3, want: "abc"},
+		// "ж" is 2 bytes, it is not cut in the middle
+		{text: "жжж", max: 3, want: "ж"},
+		{text: "жжж", max: 4, want: "жж"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateTextBytes(tt.text, tt.max); got != tt.want {
+			t.Errorf("truncateTextBytes(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
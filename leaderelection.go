@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// runWithLeaderElection runs function only while current instance holds
+// leader lease, followers wait until lease is released or expired.
+func runWithLeaderElection(run func(ctx context.Context)) {
+	id, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("failed get hostname for leader election identity: %s", err)
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaderElectionID,
+			Namespace: leaderElectionNamespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+
+	leaderelection.RunOrDie(context.TODO(), leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				klog.Fatalf("leader election lost by %s", id)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					klog.Infof("New leader elected: %s", identity)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// explainContainer returns reason why container logs are sent or not.
+func explainContainer(containerStatus v1.ContainerStatus) string {
+	terminated := containerStatus.State.Terminated
+	if terminated == nil {
+		return "container is not terminated"
+	}
+
+	if !isReasonShouldCheck(terminated.Reason) {
+		return fmt.Sprintf("reason %s is filtered", terminated.Reason)
+	}
+
+	ago := time.Since(terminated.FinishedAt.Time).Round(time.Second)
+	if isContainerLogShouldSended(containerStatus) {
+		return fmt.Sprintf("terminated with reason %s %s ago", terminated.Reason, ago)
+	}
+
+	return fmt.Sprintf("terminated with reason %s %s ago, out of delay", terminated.Reason, ago)
+}
+
+// listMonitored prints table of pods and containers in namespace and
+// whether their logs would be sent now, pods are filtered as controller
+// filters them.
+func listMonitored(out io.Writer) error {
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: podFieldSelector()})
+	if err != nil {
+		return fmt.Errorf("[listMonitored] failed list pods: %s", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPOD\tCONTAINER\tSEND\tWHY")
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		if why := explainPod(pod); len(why) > 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pod.GetNamespace(), pod.GetName(), "*", "no", why)
+			continue
+		}
+
+		pod = effectivePod(pod)
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			send := "no"
+			why := "container name is not matched"
+
+			if isContainerMatched(pod, containerStatus) {
+				if isContainerLogShouldSended(containerStatus) {
+					send = "yes"
+				}
+				why = explainContainer(containerStatus)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pod.GetNamespace(), pod.GetName(), containerStatus.Name, send, why)
+		}
+	}
+
+	return w.Flush()
+}
+
+// explainPod returns reason why pod is skipped by processPod or empty
+// string if its containers are checked.
+func explainPod(pod *v1.Pod) string {
+	switch {
+	case isNamespaceExcluded(pod.GetNamespace()):
+		return "namespace is excluded"
+	case resolveSendConfig(pod, "").ignored:
+		return "pod is ignored by annotation"
+	case !isPodMatched(pod):
+		return "pod name is not matched"
+	case !isWorkloadShouldCheck(pod):
+		return "workload is not matched"
+	}
+
+	return ""
+}
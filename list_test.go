@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListMonitored(t *testing.T) {
+	ignored := newTestPod("default", "ignored", terminatedStatus("app", "Error", 1, time.Second))
+	ignored.Annotations = map[string]string{"logs-sender/ignore": "true"}
+
+	_, restore := setupTest(t,
+		newTestPod("default", "crashed", terminatedStatus("app", "Error", 1, time.Second), runningStatus("proxy")),
+		newTestPod("kube-system", "excluded", terminatedStatus("app", "Error", 1, time.Second)),
+		ignored,
+	)
+	defer restore()
+
+	savedExclude, savedIgnoreAnnotation, savedNamespace := namespaceExcludeRegexps, ignoreAnnotation, namespace
+	defer func() {
+		namespaceExcludeRegexps, ignoreAnnotation, namespace = savedExclude, savedIgnoreAnnotation, savedNamespace
+	}()
+	namespaceExcludeRegexps = []*regexp.Regexp{regexp.MustCompile("^kube-")}
+	ignoreAnnotation = "logs-sender/ignore"
+	namespace = ""
+
+	out := new(bytes.Buffer)
+	if err := listMonitored(out); err != nil {
+		t.Fatalf("listMonitored() error = %v", err)
+	}
+
+	want := map[string]string{
+		"default/crashed/app":    "yes",
+		"default/crashed/proxy":  "no",
+		"default/ignored/*":      "no",
+		"kube-system/excluded/*": "no",
+	}
+
+	got := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		got[strings.Join(fields[:3], "/")] = fields[3]
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("listMonitored() rows = %v, want %v", got, want)
+	}
+	for row, send := range want {
+		if got[row] != send {
+			t.Errorf("listMonitored() row %s send = %q, want %q", row, got[row], send)
+		}
+	}
+}
@@ -17,15 +17,19 @@ limitations under the License.
 package main
 
 import (
-	// "flag"
+	"flag"
 	"fmt"
 	// "reflect"
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"net/url"
 	"os"
-	// "errors"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -34,13 +38,20 @@ import (
 	// "github.com/go-telegram-bot-api/telegram-bot-api"
 
 	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
 	// "k8s.io/cli-runtime/pkg/genericclioptions"
 
 	v1 "k8s.io/api/core/v1"
 	// meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -49,34 +60,298 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// errLogsNotFound is returned if pod or container disappeared before its
+// logs were fetched
+var errLogsNotFound = errors.New("pod or container not found")
+
+// noLogsNote is sent instead of empty logs with --send-empty
+const noLogsNote = "[no logs available]\n"
+
 var (
 	delay                 int64
 	chatID                int64
+	topicID               int64
 	tailLines             *int64
 	namespace             string
 	podNamePatterns       []string
 	containerNamePatterns []string
+	logGrep               string
+	logGrepContext        int
+	logExclude            string
+	routes                []string
+	chatIDAnnotation      string
+	groupByPod            bool
+	maxBytes              int
+	sendRate              float64
+	sendBurst             int
+	coalesceWindow        time.Duration
+	coalesceSendLogs      bool
+	includeReasons        []string
+	excludeReasons        []string
+	notifyPodFailures     bool
+
+	enableLeaderElection    bool
+	leaderElectionID        string
+	leaderElectionNamespace string
+
+	sendStartupMessage bool
+	streamTimeout      time.Duration
+	resyncPeriod       time.Duration
+	tailAnnotation     string
+	notifierNames      []string
+	discordWebhookURL  string
+	smtpHost           string
+	smtpFrom           string
+	smtpTo             []string
+	nameWithUID        bool
+	listenAddress      string
+
+	insecureSkipTLSVerify      bool
+	certificateAuthority       string
+	kubeQPS                    float32
+	kubeBurst                  int
+	ignoreOlderThan            time.Duration
+	stateFile                  string
+	stateFlushInterval         time.Duration
+	namespaceSelector          string
+	minContainerDuration       time.Duration
+	maxContainerDuration       time.Duration
+	messageThresholdBytes      int
+	telegramParseMode          string
+	ignoreAnnotation           string
+	attachPodManifest          bool
+	once                       bool
+	shortLogLines              int
+	sendEmpty                  bool
+	chatAliasRules             []string
+	includeEvents              bool
+	eventsLimit                int
+	retryBaseDelay             time.Duration
+	retryMaxDelay              time.Duration
+	retryQPS                   float64
+	retryBurst                 int
+	topicAnnotation            string
+	maxRetries                 int
+	namespaceExcludes          []string
+	minRestarts                int
+	minRestartsReset           time.Duration
+	notifyCooldown             time.Duration
+	telegramAPIURL             string
+	proxyURL                   string
+	workloads                  []string
+	onDelete                   bool
+	teamsWebhookURL            string
+	teamsSnippetLines          int
+	podNames                   []string
+	oncePerPod                 bool
+	ignoreSidecars             bool
+	sidecarNames               []string
+	messageTemplate            string
+	liveDuration               time.Duration
+	liveFlushInterval          time.Duration
+	listPageSize               int64
+	redact                     bool
+	redactPatterns             []string
+	autoPrevious               bool
+	logMinLevel                string
+	logLevelPattern            string
+	logLevels                  []string
+	watchJobs                  bool
+	digest                     bool
+	digestInterval             time.Duration
+	waitForPodTerminated       bool
+	impersonateUser            string
+	impersonateGroups          []string
+	workers                    int
+	maxMessageParts            int
+	deadLetterDir              string
+	quietHoursWindow           string
+	quietHoursTimezone         string
+	quietHoursMode             string
+	skipRBACCheck              bool
+	includeOOMResources        bool
+	fileNameTemplateText       string
+	sendOnStabilize            bool
+	stabilizeWindow            time.Duration
+	stabilizeMaxRestarts       int
+	watchTargets               bool
+	allowCrossNamespaceTargets bool
+	kafkaBrokers               []string
+	kafkaTopic                 string
+	kafkaTLS                   bool
+	restartRateThreshold       float64
+	restartRateWindow          time.Duration
+	nodeLogLinkTemplate        string
+	containerImages            []string
+	matchMode                  string
+	notifyWaitingReasons       []string
+	sendTimeout                time.Duration
+	sentryDSN                  string
+	sendDiff                   bool
+	maxLogFetches              int
+	notifyOn                   string
+	auditFile                  string
+	routeConfigMap             string
+	watchErrorThreshold        int
+	nodeName                   string
+	containerPriority          []string
+	maxInflightBytes           int64
+
+	notifier Notifier
+
+	logGrepRegexp           *regexp.Regexp
+	logExcludeRegexp        *regexp.Regexp
+	namespaceExcludeRegexps []*regexp.Regexp
+	logLevelRegexp          *regexp.Regexp
+	logLevelRanks           map[string]int
+	logMinLevelRank         int
+	namespaceRoutes         map[string]destination
+	podRoutes               []podRoute
+	chatAliases             map[string]destination
+	telegramAPIBase         *url.URL
+	workloadRefs            []workloadRef
+	containerImageRegexps   []*regexp.Regexp
 
 	version, commitID string
 
-	clientset *kubernetes.Clientset
+	// clientset is interface, so fake clientset may be used instead of real one
+	clientset kubernetes.Interface
 )
 
+// podInformer watches pods of single namespace, every namespace has own
+// informer factory, so it may be stopped separately.
+type podInformer struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+	// watchFailures is number of consecutive list and watch errors
+	watchFailures int
+}
+
 type Controller struct {
-	indexer  cache.Indexer
-	queue    workqueue.RateLimitingInterface
-	informer cache.Controller
+	queue workqueue.RateLimitingInterface
+
+	// factory shares informers of resources other than pods, it is
+	// started together with controller
+	factory informers.SharedInformerFactory
+
+	// namespaceInformer is optional, it adds and removes namespaces
+	// labeled with --namespace-selector.
+	namespaceInformer cache.Controller
+	// jobInformer is optional, it notifies about jobs failed with
+	// --watch-jobs.
+	jobInformer cache.Controller
+
+	// ctx is canceled when controller is stopped, it is set by Run before
+	// informers are started
+	ctx context.Context
+
+	mu           sync.RWMutex
+	running      bool
+	podInformers map[string]*podInformer
 }
 
-func NewController(queue workqueue.RateLimitingInterface, indexer cache.Indexer, informer cache.Controller) *Controller {
+func NewController(queue workqueue.RateLimitingInterface, factory informers.SharedInformerFactory) *Controller {
 	return &Controller{
+		queue:        queue,
+		factory:      factory,
+		ctx:          context.Background(),
+		podInformers: map[string]*podInformer{},
+	}
+}
+
+// AddNamespace starts watching pods in namespace.
+func (c *Controller) AddNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.podInformers[namespace]; ok {
+		return
+	}
+
+	factory, informer := newPodInformer(namespace, c.queue, func(err error) {
+		c.watchResult(namespace, err)
+	})
+	pi := &podInformer{
+		factory:  factory,
 		informer: informer,
-		indexer:  indexer,
-		queue:    queue,
+		stop:     make(chan struct{}),
+	}
+	c.podInformers[namespace] = pi
+
+	if c.running {
+		klog.Infof("Start watching namespace: %s", namespace)
+		pi.factory.Start(pi.stop)
+	}
+}
+
+// RemoveNamespace stops watching pods in namespace.
+func (c *Controller) RemoveNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pi, ok := c.podInformers[namespace]
+	if !ok {
+		return
+	}
+
+	klog.Infof("Stop watching namespace: %s", namespace)
+	close(pi.stop)
+	delete(c.podInformers, namespace)
+}
+
+// watchResult counts consecutive list and watch errors of namespace pods
+// informer and restarts informer when --watch-error-threshold is reached,
+// nil error resets counter.
+func (c *Controller) watchResult(namespace string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pi, ok := c.podInformers[namespace]
+	if !ok {
+		return
+	}
+
+	if err == nil {
+		pi.watchFailures = 0
+		return
+	}
+
+	pi.watchFailures++
+	recordWatchError(namespace)
+	klog.Errorf("[watchResult] failed list or watch pods in namespace %s, consecutive failures: %d: %s", namespace, pi.watchFailures, err)
+
+	if watchErrorThreshold > 0 && pi.watchFailures >= watchErrorThreshold {
+		pi.watchFailures = 0
+		go c.restartNamespace(namespace)
+	}
+}
+
+// restartNamespace recreates pods informer of namespace.
+func (c *Controller) restartNamespace(namespace string) {
+	klog.Warningf("Restart watching namespace: %s", namespace)
+	c.RemoveNamespace(namespace)
+	c.AddNamespace(namespace)
+}
+
+// indexerFor returns indexer of pods in namespace or nil if namespace
+// is not watched.
+func (c *Controller) indexerFor(namespace string) cache.Indexer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if pi, ok := c.podInformers[namespace]; ok {
+		return pi.informer.GetIndexer()
 	}
+
+	if pi, ok := c.podInformers[metav1.NamespaceAll]; ok {
+		return pi.informer.GetIndexer()
+	}
+
+	return nil
 }
 
-func (c *Controller) processNextItem() bool {
+func (c *Controller) processNextItem(ctx context.Context) bool {
 	// Wait until there is a new item in the working queue
 	key, quit := c.queue.Get()
 	if quit {
@@ -89,7 +364,8 @@ func (c *Controller) processNextItem() bool {
 
 	// Invoke the method containing the business logic
 	// err := c.syncToStdout(key.(string))
-	err := c.syncState(key.(string))
+	// logs failed on last retry are written to dead letter dir
+	err := c.syncState(withFinalAttempt(ctx, c.queue.NumRequeues(key) >= maxRetries), key.(string))
 	// Handle the error if something went wrong during the execution of the business logic
 	c.handleErr(err, key)
 	return true
@@ -99,8 +375,19 @@ func (c *Controller) processNextItem() bool {
 // information about the pod to stdout. In case an error happened, it has to simply return the error.
 // The retry logic should not be part of the business logic.
 // func (c *Controller) syncToStdout(key string) error {
-func (c *Controller) syncState(key string) error {
-	obj, exists, err := c.indexer.GetByKey(key)
+func (c *Controller) syncState(ctx context.Context, key string) error {
+	podNamespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("Invalid key %s: %v", key, err)
+		return nil
+	}
+
+	var obj interface{}
+	exists := false
+
+	if indexer := c.indexerFor(podNamespace); indexer != nil {
+		obj, exists, err = indexer.GetByKey(key)
+	}
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
 		return err
@@ -109,10 +396,20 @@ func (c *Controller) syncState(key string) error {
 	if !exists {
 		// Below we will warm up our cache with a Pod, so that we will see a delete for one pod
 		fmt.Printf("Pod %s does not exist anymore\n", key)
+		forgetPodFailure(key)
+		forgetRestarts(key)
+		forgetCooldowns(key)
+		forgetPodNotified(key)
+		forgetLogAnchors(key)
+		forgetWaiting(key)
+		forgetRestartRates(key)
+		forgetStabilizing(key)
 	} else {
 		// Note that you also have to check the uid if you have a local controlled resource, which
 		// is dependent on the actual instance, to detect that a Pod was recreated with the same name
-		go processPod(obj)
+		result := processPod(ctx, obj)
+		recordProcessResult(result)
+		return result.err()
 	}
 	return nil
 }
@@ -124,50 +421,94 @@ func (c *Controller) handleErr(err error, key interface{}) {
 		// This ensures that future processing of updates for this key is not delayed because of
 		// an outdated error history.
 		c.queue.Forget(key)
+		recordRequeues(key.(string), 0)
 		return
 	}
 
-	// This controller retries 5 times if something goes wrong. After that, it stops trying.
-	if c.queue.NumRequeues(key) < 5 {
+	// This controller retries --max-retries times if something goes wrong. After that, it stops trying.
+	if c.queue.NumRequeues(key) < maxRetries {
 		klog.Infof("Error syncing pod %v: %v", key, err)
 
 		// Re-enqueue the key rate limited. Based on the rate limiter on the
 		// queue and the re-enqueue history, the key will be processed later again.
 		c.queue.AddRateLimited(key)
+		recordRequeues(key.(string), c.queue.NumRequeues(key))
 		return
 	}
 
 	c.queue.Forget(key)
+	recordRequeues(key.(string), 0)
 	// Report to an external entity that, even after several retries, we could not successfully process this key
 	runtime.HandleError(err)
 	klog.Infof("Dropping pod %q out of the queue: %v", key, err)
 }
 
-func (c *Controller) Run(threadiness int, stopCh chan struct{}) {
+func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) {
 	defer runtime.HandleCrash()
 
 	// Let the workers stop when we are done
 	defer c.queue.ShutDown()
 	klog.Info("Starting Pod controller")
 
-	go c.informer.Run(stopCh)
+	// Cancel in-flight processing when controller is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var synced []cache.InformerSynced
+
+	c.mu.Lock()
+	c.running = true
+	for _, pi := range c.podInformers {
+		pi.factory.Start(pi.stop)
+		synced = append(synced, pi.informer.HasSynced)
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		for namespace, pi := range c.podInformers {
+			close(pi.stop)
+			delete(c.podInformers, namespace)
+		}
+		c.running = false
+		c.mu.Unlock()
+	}()
+
+	// namespace and job informers are run by factory
+	c.factory.Start(stopCh)
+
+	if c.namespaceInformer != nil {
+		synced = append(synced, c.namespaceInformer.HasSynced)
+	}
+
+	if c.jobInformer != nil {
+		synced = append(synced, c.jobInformer.HasSynced)
+	}
 
 	// Wait for all involved caches to be synced, before processing items from the queue is started
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, synced...) {
 		runtime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
 		return
 	}
 
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
 	}
 
 	<-stopCh
 	klog.Info("Stopping Pod controller")
 }
 
-func (c *Controller) runWorker() {
-	for c.processNextItem() {
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
 	}
 }
 
@@ -180,13 +521,140 @@ func main() {
 	pflag.BoolVar(&versionFlag, "version", false, "return application version")
 	pflag.Int64Var(&delay, "delay", 60, "delay between localtime and time in pod status field")
 	pflag.Int64Var(&chatID, "chat-id", 0, "telegram chat id")
+	pflag.Int64Var(&topicID, "telegram-topic-id", 0, "telegram forum topic id(message_thread_id) in chat")
 	pflag.StringVar(&kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file")
 	pflag.StringVar(&namespace, "namespace", "default", "monitored namespace")
 	pflag.StringArrayVar(&podNamePatterns, "pod-name-pattern", []string{}, "pod name pattern(may be regexp), which will be monitored")
 	pflag.StringArrayVar(&containerNamePatterns, "container-name-pattern", []string{}, "container name pattern(may be regexp), which will be monitored")
 
+	pflag.StringVar(&logGrep, "log-grep", "", "send only log lines matched by pattern(regexp)")
+	pflag.IntVar(&logGrepContext, "log-grep-context", 0, "num of lines around matched log line, which will be sent too")
+	pflag.StringVar(&logExclude, "log-exclude", "", "drop log lines matched by pattern(regexp), applied after --log-grep")
+	pflag.StringArrayVar(&routes, "route", []string{}, "send logs to specific telegram chat, format: namespace=chatID[:topicID] or pod:regexp=template, where template may refer regexp groups, e.g. pod:^team-(\\w+)-.*=chat-for-$1")
+	pflag.StringVar(&chatIDAnnotation, "chat-id-annotation", "logs-sender/chat-id", "pod annotation which overrides telegram chat id, format: chatID[:topicID], empty value disables it")
+	pflag.BoolVar(&groupByPod, "group-by-pod", false, "send logs of all pod containers as single document")
+	pflag.IntVar(&maxBytes, "max-bytes", 0, "max size of sent logs in bytes, older lines are truncated, 0 means no limit")
+	pflag.Float64Var(&sendRate, "send-rate", 20, "max messages per minute sent to single chat, exceeded messages fail and pod is retried, 0 means no limit")
+	pflag.IntVar(&sendBurst, "send-burst", 5, "max burst of messages sent to single chat")
+	pflag.DurationVar(&coalesceWindow, "coalesce-window", 0, "suppress repeated crashes of container within window and send summary at the end of it, 0 disables coalescing")
+	pflag.BoolVar(&coalesceSendLogs, "coalesce-send-logs", false, "send latest container logs with crashes summary")
+	pflag.StringSliceVar(&includeReasons, "include-reasons", []string{}, "send logs only for containers terminated with these reasons, e.g. Error,OOMKilled")
+	pflag.StringSliceVar(&excludeReasons, "exclude-reasons", []string{}, "don't send logs for containers terminated with these reasons, e.g. Completed")
+	pflag.BoolVar(&notifyPodFailures, "notify-pod-failures", false, "send pod description when pod goes to Failed phase, e.g. Evicted")
+	pflag.BoolVar(&enableLeaderElection, "enable-leader-election", false, "enable leader election, only leader sends logs")
+	pflag.StringVar(&leaderElectionID, "leader-election-id", "k8s-container-logs-sender", "name of lease used for leader election")
+	pflag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "default", "namespace of lease used for leader election")
+	pflag.BoolVar(&sendStartupMessage, "send-startup-message", false, "send test message to telegram chat on startup, exit if it failed")
+	pflag.DurationVar(&streamTimeout, "stream-timeout", time.Minute, "timeout of fetching container logs, 0 means no timeout")
+	pflag.DurationVar(&resyncPeriod, "resync-period", 0, "informer resync period, 0 disables resync; resynced pods are processed again, but already sent terminations are skipped")
+	pflag.StringVar(&tailAnnotation, "tail-annotation", "logs-sender/tail-lines", "pod annotation which overrides --tail, empty value disables it")
+	pflag.StringSliceVar(&notifierNames, "notifier", []string{"telegram"}, "logs destinations, logs are sent to all of them, any of: telegram, discord, smtp, teams, sentry, kafka")
+	pflag.StringVar(&discordWebhookURL, "discord-webhook-url", "", "discord channel webhook url")
+	pflag.StringVar(&smtpHost, "smtp-host", "", "smtp server address in form host:port, credentials are read from SMTP_USERNAME and SMTP_PASSWORD env")
+	pflag.StringVar(&smtpFrom, "smtp-from", "", "email sender address")
+	pflag.StringArrayVar(&smtpTo, "smtp-to", []string{}, "email recipient address")
+	pflag.BoolVar(&nameWithUID, "name-with-uid", false, "add short pod uid to sent log file names")
+	pflag.StringVar(&listenAddress, "listen-address", "", "address of health and debug http server(/healthz, /debug/errors), empty value disables it")
+	pflag.BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "don't verify kubernetes api server certificate")
+	pflag.StringVar(&certificateAuthority, "certificate-authority", "", "path to CA certificate file for kubernetes api server")
+	pflag.Float32Var(&kubeQPS, "kube-qps", 5, "kubernetes client max queries per second")
+	pflag.IntVar(&kubeBurst, "kube-burst", 10, "kubernetes client max burst of queries")
+	pflag.DurationVar(&ignoreOlderThan, "ignore-older-than", 0, "never send logs of containers finished earlier than this duration ago, 0 disables it")
+	pflag.StringVar(&stateFile, "state-file", "", "file to persist sent terminations between restarts, empty value disables persistence")
+	pflag.DurationVar(&stateFlushInterval, "state-flush-interval", 30*time.Second, "interval of sent terminations state flushing")
+	pflag.StringVar(&namespaceSelector, "namespace-selector", "", "watch pods in all namespaces matched by label selector, e.g. logs-sender/enabled=true, overrides --namespace")
+	pflag.DurationVar(&minContainerDuration, "min-container-duration", 0, "skip containers which ran less than duration, 0 disables it")
+	pflag.DurationVar(&maxContainerDuration, "max-container-duration", 0, "skip containers which ran more than duration, 0 disables it")
+	pflag.IntVar(&messageThresholdBytes, "message-threshold-bytes", 0, "send logs not larger than threshold as telegram text message instead of document, 0 disables it")
+	pflag.StringVar(&telegramParseMode, "telegram-parse-mode", "", "format of logs sent as telegram text message, one of: MarkdownV2, HTML, empty value means plain text")
+	pflag.StringVar(&ignoreAnnotation, "ignore-annotation", "logs-sender/ignore", "pod annotation which disables logs sending when set to \"true\", empty value disables it")
+	pflag.BoolVar(&attachPodManifest, "attach-pod-manifest", false, "send pod manifest with events as json document next to logs")
+	pflag.BoolVar(&once, "once", false, "send logs of recently terminated containers and exit instead of watching")
+	pflag.IntVar(&shortLogLines, "short-log-lines", 10, "previous container logs are added to logs with less lines, e.g. after kubelet log rotation, 0 disables it")
+	pflag.BoolVar(&sendEmpty, "send-empty", false, "send notification even if there are no logs to send")
+	pflag.StringArrayVar(&chatAliasRules, "chat-alias", []string{}, "named telegram chat which may be used in routes instead of chat id, format: name=chatID[:topicID]")
+	pflag.BoolVar(&includeEvents, "include-events", false, "add summary of recent pod events to caption")
+	pflag.IntVar(&eventsLimit, "events-limit", 5, "max num of pod events added to caption")
+	pflag.DurationVar(&retryBaseDelay, "retry-base-delay", 5*time.Millisecond, "base delay of failed pod processing retry, doubled on every failure")
+	pflag.DurationVar(&retryMaxDelay, "retry-max-delay", 1000*time.Second, "max delay of failed pod processing retry")
+	pflag.Float64Var(&retryQPS, "retry-qps", 10, "overall rate of pod processing retries per second")
+	pflag.IntVar(&retryBurst, "retry-burst", 100, "overall burst of pod processing retries")
+	pflag.IntVar(&maxRetries, "max-retries", 5, "max num of failed pod processing retries before pod is dropped out of the queue")
+	pflag.StringVar(&topicAnnotation, "topic-annotation", "logs-sender/topic-id", "pod annotation which overrides telegram topic id, empty value disables it")
+	pflag.StringArrayVar(&namespaceExcludes, "namespace-exclude", []string{}, "namespace pattern(may be regexp), pods of which aren't monitored, e.g. ^kube-")
+	pflag.IntVar(&minRestarts, "min-restarts", 0, "send logs only when container restart count reaches threshold, 0 disables it")
+	pflag.DurationVar(&minRestartsReset, "min-restarts-reset", 10*time.Minute, "reset restarts counter of container which is running this long")
+	pflag.DurationVar(&notifyCooldown, "notify-cooldown", 0, "don't send logs of container again within this duration after send, 0 disables it")
+	pflag.StringVar(&telegramAPIURL, "telegram-api-url", defaultTelegramAPIURL, "telegram bot api server url, self-hosted server allows to send documents larger than 50MB")
+	pflag.StringVar(&proxyURL, "proxy-url", "", "proxy for telegram and discord requests, e.g. socks5://proxy:1080, HTTPS_PROXY env var is used if empty; kubernetes client always uses HTTPS_PROXY and NO_PROXY env vars")
+	pflag.StringArrayVar(&workloads, "workload", []string{}, "workload which pods will be monitored, format: [kind/]name, e.g. Deployment/api or api")
+	pflag.BoolVar(&onDelete, "on-delete", false, "send logs of deleted pod containers which failed, terminated with non-zero exit code or within --delay, logs are sent during graceful termination of pod")
+	pflag.StringVar(&teamsWebhookURL, "teams-webhook-url", "", "microsoft teams incoming webhook url, used with --notifier=teams")
+	pflag.IntVar(&teamsSnippetLines, "teams-snippet-lines", 20, "number of first and last log lines sent to microsoft teams, 0 means whole logs")
+	pflag.StringArrayVar(&podNames, "pod-name", []string{}, "exact pod name, which will be monitored together with --pod-name-pattern")
+	pflag.BoolVar(&oncePerPod, "once-per-pod", false, "send logs at most once per pod until it is deleted")
+	pflag.BoolVar(&ignoreSidecars, "ignore-sidecars", false, "don't send logs of sidecar containers listed in --sidecar-names")
+	pflag.StringSliceVar(&sidecarNames, "sidecar-names", []string{"istio-proxy", "linkerd-proxy"}, "names of sidecar containers ignored with --ignore-sidecars")
+	pflag.StringVar(&messageTemplate, "caption-template", "", "go text/template of logs caption with fields: .Namespace, .Pod, .Container, .Reason, .ExitCode, .Message, .FinishedAt, .Image, empty value means metadata header")
+	pflag.StringVar(&messageTemplate, "message-template", "", "")
+	pflag.CommandLine.MarkDeprecated("message-template", "use --caption-template instead")
+	pflag.StringVar(&fileNameTemplateText, "filename-template", "", "go text/template of sent file name with fields of --caption-template, unsafe characters are replaced, empty value means namespace_pod_container")
+	pflag.DurationVar(&liveDuration, "live-duration", 5*time.Minute, "how long stream subcommand follows container logs")
+	pflag.DurationVar(&liveFlushInterval, "live-flush-interval", 10*time.Second, "how often stream subcommand sends accumulated logs")
+	pflag.Int64Var(&listPageSize, "list-page-size", 0, "number of pods per page of initial pods list, 0 disables pagination")
+	pflag.BoolVar(&redact, "redact", false, "replace common secrets like passwords, tokens and keys in logs with ***")
+	pflag.StringArrayVar(&redactPatterns, "redact-pattern", []string{}, "custom pattern(regexp), matches of which are replaced in logs with ***")
+	pflag.BoolVar(&autoPrevious, "auto-previous", true, "add previous container logs if container is OOMKilled or its current log is empty")
+	pflag.StringVar(&logMinLevel, "log-min-level", "", "send only log lines of this level or higher, lines without level follow previous line, e.g. WARN")
+	pflag.StringVar(&logLevelPattern, "log-level-pattern", `(?i)\b(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL|CRITICAL)\b`, "pattern(regexp) which first group extracts level of log line")
+	pflag.StringSliceVar(&logLevels, "log-levels", []string{"TRACE", "DEBUG", "INFO", "WARN|WARNING", "ERROR", "FATAL|CRITICAL"}, "log levels from lowest to highest, aliases of level are separated by |")
+	pflag.BoolVar(&watchJobs, "watch-jobs", false, "notify about failed jobs with logs of their last failed pod")
+	pflag.BoolVar(&digest, "digest", false, "accumulate logs and send them as single document to --chat-id every --digest-interval")
+	pflag.DurationVar(&digestInterval, "digest-interval", 24*time.Hour, "interval between digests")
+	pflag.BoolVar(&waitForPodTerminated, "wait-for-pod-terminated", false, "send logs of pod containers together when all of them are terminated, containers terminated earlier than --delay are skipped")
+	pflag.StringVar(&impersonateUser, "as", "", "username to impersonate for kubernetes api requests, e.g. system:serviceaccount:default:logs-sender")
+	pflag.StringArrayVar(&impersonateGroups, "as-group", []string{}, "group to impersonate for kubernetes api requests, may be repeated")
+	pflag.Int64Var(&maxInflightBytes, "max-inflight-bytes", 0, "max bytes of logs buffered by concurrent sends, send exceeded budget fails and pod is requeued, single send may exceed it when nothing else is in flight, 0 disables it")
+	pflag.StringSliceVar(&containerPriority, "container-priority", []string{}, "container names in order their logs are sent, other containers follow them in pod spec order")
+	pflag.StringVar(&nodeName, "node", "", "watch only pods scheduled to node, e.g. spec.nodeName from downward api when run as daemonset")
+	pflag.IntVar(&watchErrorThreshold, "watch-error-threshold", 5, "restart pods informer of namespace after this number of consecutive list or watch errors, 0 disables it")
+	pflag.StringVar(&routeConfigMap, "route-configmap", "", "configmap namespace/name which data maps namespace to chatID[:topicID], it is watched and overrides namespace routes of --route")
+	pflag.StringVar(&auditFile, "audit-file", "", "append json line for every logs send attempt to file, \"-\" means stdout")
+	pflag.StringVar(&notifyOn, "notify-on", notifyOnTerminated, "container state which triggers send, one of: terminated, restarted(last termination of restarted container), both")
+	pflag.IntVar(&maxLogFetches, "max-concurrent-log-fetches", 0, "max number of concurrent container log streams, 0 means no limit")
+	pflag.BoolVar(&sendDiff, "send-diff", false, "send only container logs which are new since last send of the same container")
+	pflag.StringVar(&sentryDSN, "sentry-dsn", "", "sentry project dsn, used with --notifier=sentry")
+	pflag.DurationVar(&sendTimeout, "send-timeout", time.Minute, "timeout of single send to notifier, 0 means no timeout")
+	pflag.StringSliceVar(&notifyWaitingReasons, "notify-waiting-reasons", []string{}, "send container description when container is waiting with these reasons, e.g. ImagePullBackOff,CreateContainerError")
+	pflag.StringArrayVar(&containerImages, "container-image-pattern", []string{}, "container image pattern(regexp), which will be monitored together with --container-name-pattern")
+	pflag.StringVar(&matchMode, "match-mode", "any", "how container name and image patterns are combined, one of: any, all")
+	pflag.StringVar(&nodeLogLinkTemplate, "node-log-link-template", "", "go text/template of link to logging system appended to logs caption with fields: .Node, .Pod, .Namespace")
+	pflag.Float64Var(&restartRateThreshold, "restart-rate-threshold", 0, "send last crash logs of container restarting more than this number of times per minute, even if it is running now, 0 disables")
+	pflag.DurationVar(&restartRateWindow, "restart-rate-window", 10*time.Minute, "window over which restart rate is measured")
+	pflag.StringSliceVar(&kafkaBrokers, "kafka-brokers", []string{}, "kafka bootstrap brokers host:port, used with --notifier=kafka")
+	pflag.StringVar(&kafkaTopic, "kafka-topic", "", "kafka topic which logs are published to, used with --notifier=kafka")
+	pflag.BoolVar(&kafkaTLS, "kafka-tls", false, "connect to kafka brokers over TLS verified by system root certificates, used with --notifier=kafka")
+	pflag.BoolVar(&watchTargets, "watch-targets", false, "watch LogForwardTarget resources, their namespace, pod and container patterns replace --pod-name, --pod-name-pattern, --container-name-pattern and --container-image-pattern, their chat overrides routes")
+	pflag.BoolVar(&allowCrossNamespaceTargets, "allow-cross-namespace-targets", false, "allow LogForwardTarget spec.namespace other than namespace of resource, otherwise such targets are skipped")
+	pflag.BoolVar(&sendOnStabilize, "send-on-stabilize", false, "send logs of last crash of container once it stops restarting for --stabilize-window")
+	pflag.DurationVar(&stabilizeWindow, "stabilize-window", 5*time.Minute, "time without crashes after which container is stable, used with --send-on-stabilize")
+	pflag.IntVar(&stabilizeMaxRestarts, "stabilize-max-restarts", 0, "send logs without waiting for stabilization after this number of crashes, 0 means no limit, used with --send-on-stabilize")
+	pflag.BoolVar(&includeOOMResources, "include-oom-resources", false, "add resource requests and limits of container killed by OOM to logs caption")
+	pflag.BoolVar(&skipRBACCheck, "skip-rbac-check", false, "skip startup check that service account may read pods and their logs")
+	pflag.StringVar(&quietHoursWindow, "quiet-hours", "", "daily window in format HH:MM-HH:MM, e.g. 22:00-07:00, when logs are not sent, messages are sent as usual")
+	pflag.StringVar(&quietHoursTimezone, "quiet-hours-timezone", "UTC", "timezone of --quiet-hours, e.g. Europe/Moscow")
+	pflag.StringVar(&quietHoursMode, "quiet-hours-mode", quietHoursBuffer, "what to do with logs during quiet hours, one of: buffer, drop; buffered logs are sent when quiet hours end")
+	pflag.StringVar(&deadLetterDir, "dead-letter-dir", "", "directory where logs and failure metadata are written when last send attempt failed")
+	pflag.IntVar(&maxMessageParts, "max-message-parts", 0, "split logs not larger than --message-threshold-bytes, which don't fit single telegram message, into this number of messages instead of sending document, 0 disables it")
+	pflag.IntVar(&workers, "workers", 1, "num of workers processing pods concurrently")
+
 	tailLines = pflag.Int64("tail", 100000, "tail last num lines")
 
+	// register klog flags, e.g. -v and --logtostderr
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	pflag.CommandLine.AddGoFlagSet(klogFlags)
+
 	pflag.Parse()
 
 	if versionFlag {
@@ -199,6 +667,118 @@ func main() {
 		os.Exit(0)
 	}
 
+	err = validateFlags()
+	if err != nil {
+		klog.Fatalf("invalid flags: %s", err)
+	}
+
+	if len(logGrep) > 0 {
+		logGrepRegexp, err = regexp.Compile(logGrep)
+		if err != nil {
+			klog.Fatalf("failed compile log grep pattern: %s", err)
+		}
+	}
+
+	if len(logExclude) > 0 {
+		logExcludeRegexp, err = regexp.Compile(logExclude)
+		if err != nil {
+			klog.Fatalf("failed compile log exclude pattern: %s", err)
+		}
+	}
+
+	if len(logMinLevel) > 0 {
+		logLevelRegexp, err = regexp.Compile(logLevelPattern)
+		if err != nil {
+			klog.Fatalf("failed compile log level pattern: %s", err)
+		}
+
+		logLevelRanks = parseLogLevels(logLevels)
+		logMinLevelRank, err = minLevelRank(logLevelRanks, logMinLevel)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	for _, pattern := range containerImages {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			klog.Fatalf("failed compile container image pattern %s: %s", pattern, err)
+		}
+		containerImageRegexps = append(containerImageRegexps, re)
+	}
+
+	for _, pattern := range namespaceExcludes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			klog.Fatalf("failed compile namespace exclude pattern %s: %s", pattern, err)
+		}
+		namespaceExcludeRegexps = append(namespaceExcludeRegexps, re)
+	}
+
+	if len(messageTemplate) > 0 {
+		captionTemplate, err = parseTemplate("caption", messageTemplate, captionData{})
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	if len(fileNameTemplateText) > 0 {
+		fileNameTemplate, err = parseTemplate("filename", fileNameTemplateText, captionData{})
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	if len(nodeLogLinkTemplate) > 0 {
+		nodeLogLink, err = parseTemplate("node log link", nodeLogLinkTemplate, nodeLogLinkData{})
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	redactions, err = parseRedactions(redact, redactPatterns)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	workloadRefs, err = parseWorkloads(workloads)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	chatAliases, err = parseChatAliases(chatAliasRules)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	namespaceRoutes, podRoutes, err = parseRoutes(routes)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if maxLogFetches > 0 {
+		logFetches = make(chan struct{}, maxLogFetches)
+	}
+
+	if len(deadLetterDir) > 0 {
+		err = os.MkdirAll(deadLetterDir, 0755)
+		if err != nil {
+			klog.Fatalf("failed create dead letter dir: %s", err)
+		}
+	}
+
+	if len(auditFile) > 0 {
+		err = openAudit(auditFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	notifier, err = newNotifiers(notifierNames)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
 	// creates the connection
 	if len(kubeconfig) > 0 {
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -209,30 +789,255 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	if len(certificateAuthority) > 0 {
+		config.TLSClientConfig.CAFile = certificateAuthority
+		config.TLSClientConfig.CAData = nil
+	}
+
+	// CA can't be specified together with insecure mode
+	if insecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+
+	config.QPS = kubeQPS
+	config.Burst = kubeBurst
+
+	if len(impersonateUser) > 0 || len(impersonateGroups) > 0 {
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: impersonateUser,
+			Groups:   impersonateGroups,
+		}
+	}
+
 	// creates the clientset
 	clientset, err = kubernetes.NewForConfig(config)
 	if err != nil {
 		klog.Fatal(err)
 	}
 
-	// create the pod watcher
-	// podListWatcher := cache.NewListWatchFromClient(clientset.CoreV1().RESTClient(), "pods", v1.NamespaceDefault, fields.Everything())
-	podListWatcher := cache.NewListWatchFromClient(clientset.CoreV1().RESTClient(), "pods", namespace, fields.Everything())
+	// node may be not readable by service account, so it is not fatal
+	if len(nodeName) > 0 {
+		_, err = clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("Failed get node %s, check --node: %s", nodeName, err)
+		}
+	}
+
+	if !skipRBACCheck {
+		err = checkAccess(context.TODO(), requiredAccesses())
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	if len(routeConfigMap) > 0 {
+		informer, err := newRouteConfigMapInformer(routeConfigMap)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		go informer.Run(wait.NeverStop)
+	}
+
+	// pods aren't matched until targets are synced, targets are watched
+	// in all namespaces if namespaces are selected by labels
+	if watchTargets {
+		targetsNamespace := namespace
+		if len(namespaceSelector) > 0 {
+			targetsNamespace = metav1.NamespaceAll
+		}
+
+		informer, err := newTargetInformer(config, targetsNamespace)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		go informer.Run(wait.NeverStop)
+		if !cache.WaitForCacheSync(wait.NeverStop, informer.HasSynced) {
+			klog.Fatal("failed sync log forward targets")
+		}
+	}
+
+	if pflag.Arg(0) == "list" {
+		err = listMonitored(os.Stdout)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// digest is not applied to subcommands below, logs requested by them
+	// are sent at once, digest would be lost on exit
+	if pflag.Arg(0) == "stream" || pflag.Arg(0) == "resend" {
+		digest = false
+	}
+
+	// stream <namespace>/<pod> [container] follows logs of single container
+	if pflag.Arg(0) == "stream" {
+		if pflag.NArg() < 2 {
+			klog.Fatal("stream subcommand requires namespace/pod")
+		}
+		err = streamLogs(pflag.Arg(1), pflag.Arg(2))
+		if err != nil {
+			klog.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// resend <namespace>/<pod> [container] sends logs of past pod
+	if pflag.Arg(0) == "resend" {
+		if pflag.NArg() < 2 {
+			klog.Fatal("resend subcommand requires namespace/pod")
+		}
+		err = resendLogs(context.TODO(), pflag.Arg(1), pflag.Arg(2))
+		if err != nil {
+			klog.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// quiet hours are not applied to subcommands above, logs requested by
+	// them are sent at once, buffered logs would be lost on exit
+	if len(quietHoursWindow) > 0 {
+		quiet, err = parseQuietHours(quietHoursWindow, quietHoursTimezone, quietHoursMode)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	if usesNotifier("telegram") {
+		err = validateTelegramChats(configuredChatIDs())
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	printConfig(os.Stdout)
+
+	if sendStartupMessage {
+		watched := namespace
+		if len(watched) == 0 {
+			watched = "all namespaces"
+		}
+
+		text := fmt.Sprintf("logs-sender started, watching namespace %s", watched)
+		err = sendMessage(context.TODO(), nil, text)
+		if err != nil {
+			klog.Fatalf("failed send startup message: %s", err)
+		}
+	}
+
+	if len(listenAddress) > 0 {
+		go serveDebug(listenAddress)
+	}
+
+	if len(stateFile) > 0 {
+		err = loadState(stateFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+	go wait.Forever(flushState, stateFlushInterval)
+
+	if digest {
+		go wait.Forever(func() { flushDigest(context.TODO()) }, digestInterval)
+	}
+
+	if quiet != nil && quietHoursMode == quietHoursBuffer {
+		go wait.Forever(func() { flushQuiet(context.TODO()) }, time.Minute)
+	}
+
+	if once {
+		err = runOnce(context.TODO())
+		if err != nil {
+			klog.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
 	// create the workqueue
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	queue := workqueue.NewRateLimitingQueue(newRateLimiter())
+
+	// jobs are watched in all namespaces if namespaces are selected by
+	// labels
+	factoryNamespace := namespace
+	if len(namespaceSelector) > 0 {
+		factoryNamespace = metav1.NamespaceAll
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace(factoryNamespace))
+
+	controller := NewController(queue, factory)
+	if len(namespaceSelector) > 0 {
+		controller.namespaceInformer = newNamespaceInformer(controller, namespaceSelector)
+	} else {
+		controller.AddNamespace(namespace)
+	}
+
+	if watchJobs {
+		controller.jobInformer = newJobInformer(controller)
+	}
+
+	if enableLeaderElection {
+		runWithLeaderElection(func(ctx context.Context) {
+			controller.Run(workers, ctx.Done())
+		})
+		return
+	}
+
+	// Now let's start the controller
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(workers, stop)
+
+	// Wait forever
+	select {}
+}
+
+// newRateLimiter returns workqueue rate limiter like default controller one,
+// but with configurable retry delays and overall rate.
+func newRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(retryBaseDelay, retryMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(retryQPS), retryBurst)},
+	)
+}
+
+// podFieldSelector returns field selector of watched pods.
+func podFieldSelector() string {
+	if len(nodeName) > 0 {
+		return fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+	}
+
+	return fields.Everything().String()
+}
+
+// newPodInformer returns informer of pods in namespace which adds pod keys
+// to queue, result of every list and watch call is passed to onWatch.
+func newPodInformer(namespace string, queue workqueue.RateLimitingInterface, onWatch func(error)) (informers.SharedInformerFactory, cache.SharedIndexInformer) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace(namespace))
+
+	// pods informer of factory is replaced by informer with own list and
+	// watch, which select pods of --node, read list by pages and report
+	// errors.
+	informer := factory.InformerFor(&v1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(newPodListWatch(client, namespace, onWatch), &v1.Pod{}, resync, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	})
 
 	// Bind the workqueue to a cache with the help of an informer. This way we make sure that
 	// whenever the cache is updated, the pod key is added to the workqueue.
 	// Note that when we finally process the item from the workqueue, we might see a newer version
 	// of the Pod than the version which was responsible for triggering the update.
-	indexer, informer := cache.NewIndexerInformer(podListWatcher, &v1.Pod{}, 0, cache.ResourceEventHandlerFuncs{
+	// Resync redelivers every cached pod as update, terminations already sent are
+	// remembered by claimTermination, so their logs are not sent twice.
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
 				queue.Add(key)
 			}
 		},
+		// deletion timestamp is set by update, so logs of terminating pod
+		// are sent with --on-delete before pod is removed
 		UpdateFunc: func(old interface{}, new interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(new)
 			if err == nil {
@@ -247,45 +1052,272 @@ func main() {
 				queue.Add(key)
 			}
 		},
-	}, cache.Indexers{})
+	})
 
-	controller := NewController(queue, indexer, informer)
+	return factory, informer
+}
 
-	// Now let's start the controller
-	stop := make(chan struct{})
-	defer close(stop)
-	go controller.Run(1, stop)
+// newPodListWatch returns list and watch of pods in namespace, onWatch is
+// called with result of every list and watch.
+func newPodListWatch(client kubernetes.Interface, namespace string, onWatch func(error)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (kruntime.Object, error) {
+			options.FieldSelector = podFieldSelector()
+			// list from watch cache(resourceVersion 0) ignores limit, so
+			// paginated list is read from etcd
+			if listPageSize > 0 {
+				options.Limit = listPageSize
+				options.ResourceVersion = ""
+			}
+			list, err := client.CoreV1().Pods(namespace).List(context.TODO(), options)
+			onWatch(err)
+			return list, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = podFieldSelector()
+			w, err := client.CoreV1().Pods(namespace).Watch(context.TODO(), options)
+			onWatch(err)
+			return w, err
+		},
+	}
+}
 
-	// Wait forever
-	select {}
+// openPodLogs opens logs stream of pod, fake clientset does not serve
+// logs, so tests replace it.
+var openPodLogs = func(ctx context.Context, pod *v1.Pod, opts *v1.PodLogOptions) (io.ReadCloser, error) {
+	return clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
 }
 
-func sendContainerLogs(pod *v1.Pod, containerName string) error {
+func streamContainerLogs(ctx context.Context, pod *v1.Pod, containerName string, previous bool) (*bytes.Buffer, error) {
 	podLogOpts := v1.PodLogOptions{
 		Container: containerName,
-		TailLines: tailLines,
+		TailLines: resolveSendConfig(pod, containerName).tailLines,
+		Previous:  previous,
+	}
+
+	if streamTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, streamTimeout)
+		defer cancel()
 	}
 
-	req := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &podLogOpts)
-	podLogs, err := req.Stream(context.TODO())
+	release, err := acquireLogFetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[streamContainerLogs] failed wait for log fetch slot: %s", err)
+	}
+	defer release()
+
+	podLogs, err := openPodLogs(ctx, pod, &podLogOpts)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("[streamContainerLogs] failed create stream: %w", errLogsNotFound)
+	}
 	if err != nil {
-		return fmt.Errorf("[sendContainerLogs] failed create stream: %s", err)
+		return nil, fmt.Errorf("[streamContainerLogs] failed create stream: %s", err)
 	}
 	defer podLogs.Close()
 
 	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
+	_, err = io.Copy(buf, budgetedReader(ctx, podLogs))
+	if err != nil {
+		return nil, fmt.Errorf("[streamContainerLogs] failed copy pod logs to buffer: %s", err)
+	}
+
+	return buf, nil
+}
+
+// getContainerLogs returns container logs, previous container logs are
+// added if withPrevious is set or they are needed to recover context.
+func getContainerLogs(ctx context.Context, pod *v1.Pod, containerName string, withPrevious bool) (*bytes.Buffer, error) {
+	containerStatus := findContainerStatus(pod, containerName)
+
+	// logs of crashed instance of restarted container are previous logs
+	restarted := containerStatus != nil && isRestartedStatus(*containerStatus)
+
+	buf, err := streamContainerLogs(ctx, pod, containerName, restarted)
+	if err != nil {
+		return nil, fmt.Errorf("[getContainerLogs] failed get current logs: %w", err)
+	}
+
+	// Kubelet may rotate large logs, so current log is short, previous
+	// container logs are added to recover context.
+	if !restarted && containerStatus != nil && containerStatus.RestartCount > 0 &&
+		(withPrevious || isShortLog(buf) || isPreviousLogNeeded(pod, containerName, buf)) {
+		previous, err := streamContainerLogs(ctx, pod, containerName, true)
+		if err != nil {
+			klog.V(2).Infof("No previous logs of pod: %s, container: %s: %s", pod.GetName(), containerName, err)
+		} else if previous.Len() > 0 {
+			combined := new(bytes.Buffer)
+			combined.WriteString("===== previous container logs =====\n")
+			combined.Write(previous.Bytes())
+			if !bytes.HasSuffix(previous.Bytes(), []byte("\n")) {
+				combined.WriteByte('\n')
+			}
+			combined.WriteString("===== current container logs =====\n")
+			combined.Write(buf.Bytes())
+			buf = combined
+		}
+	}
+
+	if isLogFilterEnabled() {
+		buf = filterLogLines(buf)
+	}
+
+	return redactLogs(buf), nil
+}
+
+func isShortLog(logs *bytes.Buffer) bool {
+	return shortLogLines > 0 && bytes.Count(logs.Bytes(), []byte("\n")) < shortLogLines
+}
+
+// isPreviousLogNeeded reports whether previous container logs should be
+// added with --auto-previous, container killed by OOM or with empty current
+// log usually has useful previous log.
+func isPreviousLogNeeded(pod *v1.Pod, containerName string, logs *bytes.Buffer) bool {
+	if !autoPrevious {
+		return false
+	}
+
+	return logs.Len() == 0 || containerTerminationReason(pod, containerName) == "OOMKilled"
+}
+
+// withEvents prepends summary of recent pod events to caption if
+// --include-events is set.
+func withEvents(ctx context.Context, pod *v1.Pod, caption string) string {
+	if !includeEvents {
+		return caption
+	}
+
+	summary, err := eventsSummary(ctx, pod, eventsLimit)
 	if err != nil {
-		return fmt.Errorf("[sendContainerLogs] failed copy pod logs to buffer: %s", err)
+		klog.Errorf("[withEvents] failed get events of pod %s: %s", pod.GetName(), err)
+		return caption
 	}
 
-	prefix := fmt.Sprintf("%s_%s", pod.GetName(), containerName)
+	return summary + caption
+}
+
+func sendContainerLogs(ctx context.Context, pod *v1.Pod, containerName string, withPrevious bool) error {
+	ctx, release := withBudget(ctx)
+	defer release()
 
-	err = sendLogsToTelegram(chatID, buf, prefix)
+	buf, err := getContainerLogs(ctx, pod, containerName, withPrevious)
+	if errors.Is(err, errLogsNotFound) {
+		klog.V(2).Infof("Skip logs of disappeared pod: %s, container: %s", pod.GetName(), containerName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[sendContainerLogs] failed get logs: %s", err)
+	}
+
+	var anchor []byte
+	if sendDiff {
+		anchor = logAnchor(buf)
+		buf = logsSinceLastSend(pod, containerName, buf)
+	}
+
+	if buf.Len() == 0 {
+		if !sendEmpty {
+			klog.V(2).Infof("Nothing to send from pod: %s, container: %s", pod.GetName(), containerName)
+			return nil
+		}
+		buf.WriteString(noLogsNote)
+	}
+
+	caption := withNodeLogLink(pod, containerCaption(pod, containerName))
+
+	if digest {
+		addToDigest(pod, caption, buf)
+		rememberLogAnchor(pod, containerName, anchor)
+		return nil
+	}
+
+	err = sendNotification(ctx, &notification{
+		pod:           pod,
+		containerName: containerName,
+		name:          notificationName(pod, containerName),
+		reason:        containerTerminationReason(pod, containerName),
+		caption:       withEvents(ctx, pod, caption),
+		logs:          truncateLogs(buf, maxBytes),
+	})
 	if err != nil {
 		return fmt.Errorf("[sendContainerLogs] failed send message: %s", err)
 	}
 
+	rememberLogAnchor(pod, containerName, anchor)
+
+	if attachPodManifest {
+		// logs are already sent, so manifest failure must not cause resend
+		err = sendPodManifest(ctx, pod)
+		if err != nil {
+			klog.Errorf("[sendContainerLogs] failed send pod manifest: %s", err)
+			recordSendError(pod, err)
+		}
+	}
+
+	return nil
+}
+
+// sendPodLogs sends logs of several pod containers as single document,
+// every container log is preceded by header with container name.
+func sendPodLogs(ctx context.Context, pod *v1.Pod, containerNames []string) error {
+	ctx, release := withBudget(ctx)
+	defer release()
+
+	buf := new(bytes.Buffer)
+
+	for _, containerName := range containerNames {
+		logs, err := getContainerLogs(ctx, pod, containerName, false)
+		if err != nil {
+			klog.Errorf("[sendPodLogs] failed get container %s logs: %s", containerName, err)
+			fmt.Fprintf(buf, "===== container: %s =====\n[failed get logs: %s]\n", containerName, err)
+			continue
+		}
+
+		if logs.Len() == 0 {
+			if !sendEmpty {
+				continue
+			}
+			logs.WriteString(noLogsNote)
+		}
+
+		fmt.Fprintf(buf, "===== container: %s =====\n", containerName)
+		buf.Write(logs.Bytes())
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+
+	if buf.Len() == 0 {
+		klog.V(2).Infof("Nothing to send from pod: %s", pod.GetName())
+		return nil
+	}
+
+	caption := withNodeLogLink(pod, podCaption(pod, containerNames))
+
+	if digest {
+		addToDigest(pod, caption, buf)
+		return nil
+	}
+
+	err := sendNotification(ctx, &notification{
+		pod:     pod,
+		name:    notificationName(pod, ""),
+		caption: withEvents(ctx, pod, caption),
+		logs:    truncateLogs(buf, maxBytes),
+	})
+	if err != nil {
+		return fmt.Errorf("[sendPodLogs] failed send message: %s", err)
+	}
+
+	if attachPodManifest {
+		// logs are already sent, so manifest failure must not cause resend
+		err = sendPodManifest(ctx, pod)
+		if err != nil {
+			klog.Errorf("[sendPodLogs] failed send pod manifest: %s", err)
+			recordSendError(pod, err)
+		}
+	}
+
 	return nil
 }
 
@@ -303,12 +1335,67 @@ func isShouldCheck(name string, list []string) bool {
 	return false
 }
 
-func isPodShouldCheck(podName string, podList []string) bool {
-	if len(podList) == 0 {
+// isPodMatched reports whether pod is matched by LogForwardTarget with
+// --watch-targets or by pod names and name patterns otherwise.
+func isPodMatched(pod *v1.Pod) bool {
+	if !watchTargets {
+		return isPodShouldCheck(pod.GetName(), podNames, podNamePatterns)
+	}
+
+	if target, ok := matchForwardTarget(pod, ""); ok {
+		klog.V(4).Infof("Pod %s is checked, matched target: %s", pod.GetName(), target.name)
 		return true
-	} else {
-		for _, pod := range podList {
-			if matched, _ := regexp.MatchString(pod, podName); matched {
+	}
+
+	klog.V(4).Infof("Pod %s is skipped, no target matched", pod.GetName())
+	return false
+}
+
+// isPodShouldCheck reports whether pod name is one of exact names or
+// matched by one of patterns, exact names are checked first.
+func isPodShouldCheck(podName string, nameList []string, podList []string) bool {
+	if len(nameList) == 0 && len(podList) == 0 {
+		klog.V(4).Infof("Pod %s is checked, no pod names and name patterns", podName)
+		return true
+	}
+
+	for _, name := range nameList {
+		if name == podName {
+			klog.V(4).Infof("Pod %s is checked, matched name", podName)
+			return true
+		}
+	}
+
+	for _, pod := range podList {
+		if matched, _ := regexp.MatchString(pod, podName); matched {
+			klog.V(4).Infof("Pod %s is checked, matched pattern: %s", podName, pod)
+			return true
+		}
+	}
+
+	klog.V(4).Infof("Pod %s is skipped, no pod name or name pattern matched", podName)
+	return false
+}
+
+// isNamespaceExcluded reports whether namespace is matched by one of
+// --namespace-exclude patterns.
+func isNamespaceExcluded(namespace string) bool {
+	for _, re := range namespaceExcludeRegexps {
+		if re.MatchString(namespace) {
+			klog.V(4).Infof("Namespace %s is skipped, matched exclude pattern: %s", namespace, re)
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSidecar reports whether container is ignored with --ignore-sidecars.
+func isSidecar(containerName string) bool {
+	if ignoreSidecars {
+		for _, sidecar := range sidecarNames {
+			if sidecar == containerName {
+				klog.V(4).Infof("Container %s is skipped, sidecar", containerName)
 				return true
 			}
 		}
@@ -318,48 +1405,320 @@ func isPodShouldCheck(podName string, podList []string) bool {
 }
 
 func isContainerShouldCheck(containerName string, containerList []string) bool {
-	return isShouldCheck(containerName, containerList)
+	if isSidecar(containerName) {
+		return false
+	}
+
+	if isShouldCheck(containerName, containerList) {
+		klog.V(4).Infof("Container %s is checked", containerName)
+		return true
+	}
+
+	klog.V(4).Infof("Container %s is skipped, not in container list", containerName)
+	return false
+}
+
+// isContainerMatched reports whether container is matched by name and
+// image patterns combined by --match-mode.
+func isContainerMatched(pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	if watchTargets {
+		return !isSidecar(containerStatus.Name) && isTargetContainer(pod, containerStatus.Name)
+	}
+
+	if len(containerImageRegexps) == 0 {
+		return isContainerShouldCheck(containerStatus.Name, containerNamePatterns)
+	}
+
+	imageMatched := false
+	for _, re := range containerImageRegexps {
+		if re.MatchString(containerStatus.Image) {
+			klog.V(4).Infof("Container %s image %s matched pattern: %s", containerStatus.Name, containerStatus.Image, re)
+			imageMatched = true
+			break
+		}
+	}
+
+	if matchMode == "all" {
+		return imageMatched && isContainerShouldCheck(containerStatus.Name, containerNamePatterns)
+	}
+
+	if isSidecar(containerStatus.Name) {
+		return false
+	}
+
+	// empty name list matches any container, so it is ignored in any mode
+	return imageMatched || (len(containerNamePatterns) > 0 && isContainerShouldCheck(containerStatus.Name, containerNamePatterns))
+}
+
+// matchedRule returns pod and container rules which selected container
+// logs for sending.
+func matchedRule(pod *v1.Pod, containerName string) string {
+	podRule := "any pod"
+	for _, name := range podNames {
+		if name == pod.GetName() {
+			podRule = fmt.Sprintf("pod name %s", name)
+		}
+	}
+	if podRule == "any pod" {
+		for _, pattern := range podNamePatterns {
+			if matched, _ := regexp.MatchString(pattern, pod.GetName()); matched {
+				podRule = fmt.Sprintf("pod pattern %s", pattern)
+				break
+			}
+		}
+	}
+
+	containerRule := "any container"
+	if len(containerNamePatterns) > 0 {
+		containerRule = fmt.Sprintf("container name %s", containerName)
+	}
+
+	return fmt.Sprintf("%s, %s", podRule, containerRule)
+}
+
+func isReasonShouldCheck(reason string) bool {
+	for _, r := range excludeReasons {
+		if r == reason {
+			return false
+		}
+	}
+
+	return isShouldCheck(reason, includeReasons)
 }
 
 func isContainerLogShouldSended(containerStatus v1.ContainerStatus) bool {
 	containerState := containerStatus.State
 	if containerState.Terminated != nil {
+		if !isReasonShouldCheck(containerState.Terminated.Reason) {
+			klog.V(4).Infof("Container %s is skipped, reason %s is filtered", containerStatus.Name, containerState.Terminated.Reason)
+			return false
+		}
+
+		// zero timestamps of malformed status make duration and delay meaningless
+		if containerState.Terminated.StartedAt.IsZero() || containerState.Terminated.FinishedAt.IsZero() {
+			klog.V(3).Infof("Container %s is skipped, terminated status has zero startedAt or finishedAt", containerStatus.Name)
+			return false
+		}
+
 		startedAt := containerState.Terminated.StartedAt.Unix()
 		finishedAt := containerState.Terminated.FinishedAt.Unix()
 
 		now := time.Now().Unix()
 
+		if ignoreOlderThan > 0 && (now-finishedAt) >= int64(ignoreOlderThan.Seconds()) {
+			klog.V(4).Infof("Container %s is skipped, finished %ds ago, older than %s", containerStatus.Name, now-finishedAt, ignoreOlderThan)
+			return false
+		}
+
+		duration := finishedAt - startedAt
+		if minContainerDuration > 0 && duration < int64(minContainerDuration.Seconds()) {
+			klog.V(4).Infof("Container %s is skipped, ran %ds, less than %s", containerStatus.Name, duration, minContainerDuration)
+			return false
+		}
+		if maxContainerDuration > 0 && duration > int64(maxContainerDuration.Seconds()) {
+			klog.V(4).Infof("Container %s is skipped, ran %ds, more than %s", containerStatus.Name, duration, maxContainerDuration)
+			return false
+		}
+
 		if (startedAt < finishedAt) && ((now - finishedAt) < delay) {
+			klog.V(4).Infof("Container %s is sent, terminated with reason %s %ds ago, within delay %ds", containerStatus.Name, containerState.Terminated.Reason, now-finishedAt, delay)
 			return true
 		}
+
+		klog.V(4).Infof("Container %s is skipped, started at %d, finished %ds ago, out of delay %ds", containerStatus.Name, startedAt, now-finishedAt, delay)
+		return false
 	}
 
+	klog.V(4).Infof("Container %s is skipped, not terminated", containerStatus.Name)
 	return false
 }
 
-func processContainers(pod *v1.Pod) {
+// orderContainerStatuses returns statuses sorted by --container-priority,
+// statuses of containers not in the list keep their order after them.
+func orderContainerStatuses(statuses []v1.ContainerStatus) []v1.ContainerStatus {
+	if len(containerPriority) == 0 {
+		return statuses
+	}
+
+	priority := func(name string) int {
+		for i, n := range containerPriority {
+			if n == name {
+				return i
+			}
+		}
+		return len(containerPriority)
+	}
+
+	ordered := make([]v1.ContainerStatus, len(statuses))
+	copy(ordered, statuses)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return priority(ordered[i].Name) < priority(ordered[j].Name)
+	})
+
+	return ordered
+}
+
+// isPodTerminated reports whether all matched containers of pod are
+// terminated.
+func isPodTerminated(pod *v1.Pod) bool {
 	for _, containerStatus := range pod.Status.ContainerStatuses {
-		if isContainerShouldCheck(containerStatus.Name, containerNamePatterns) {
+		if isContainerMatched(pod, containerStatus) && containerStatus.State.Terminated == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func processContainers(ctx context.Context, pod *v1.Pod) processResult {
+	var result processResult
+	var containerStatuses []v1.ContainerStatus
+
+	if isPodNotified(pod) {
+		return result
+	}
+
+	if waitForPodTerminated && !isPodTerminated(pod) {
+		klog.V(4).Infof("Pod %s is deferred, not all containers are terminated", pod.GetName())
+		return result
+	}
+
+	for _, containerStatus := range orderContainerStatuses(pod.Status.ContainerStatuses) {
+		observeRestarts(pod, containerStatus)
+
+		if isContainerMatched(pod, containerStatus) {
+			result.containers++
+
 			if isContainerLogShouldSended(containerStatus) {
-				klog.Infof("Send logs from pod: %s, container: %s", pod.GetName(), containerStatus.Name)
+				if !isRestartsReached(pod, containerStatus) {
+					continue
+				}
+
+				if !claimTermination(pod, containerStatus) {
+					continue
+				}
+
+				if !coalesceCrash(ctx, pod, containerStatus) {
+					klog.Infof("Suppress repeated crash of pod: %s, container: %s", pod.GetName(), containerStatus.Name)
+					continue
+				}
+
+				if !claimCooldown(pod, containerStatus.Name) {
+					continue
+				}
 
-				err := sendContainerLogs(pod, containerStatus.Name)
+				if groupByPod || waitForPodTerminated {
+					containerStatuses = append(containerStatuses, containerStatus)
+					continue
+				}
+
+				if sendOnStabilize {
+					deferUntilStable(ctx, pod, containerStatus.Name)
+					continue
+				}
+
+				klog.Infof("Send logs from pod: %s, container: %s, reason: %s, matched: %s", pod.GetName(), containerStatus.Name, containerStatus.State.Terminated.Reason, matchedRule(pod, containerStatus.Name))
+
+				err := sendContainerLogs(ctx, pod, containerStatus.Name, false)
 				if err != nil {
 					klog.Errorf("[processContainers] failed sed contianer logs: %s", err)
+					recordSendError(pod, err)
+					releaseTermination(pod, containerStatus)
+					releaseCooldown(pod, containerStatus.Name)
+					releaseCrash(pod, containerStatus)
+					result.errs = append(result.errs, err)
+					continue
+				}
+
+				result.sent++
+
+				if oncePerPod {
+					markPodNotified(pod)
+					return result
 				}
 			}
 		}
 	}
+
+	if len(containerStatuses) > 0 {
+		containerNames := make([]string, 0, len(containerStatuses))
+		for _, containerStatus := range containerStatuses {
+			containerNames = append(containerNames, containerStatus.Name)
+		}
+
+		klog.Infof("Send logs from pod: %s, containers: %s, matched: %s", pod.GetName(), strings.Join(containerNames, ", "), matchedRule(pod, strings.Join(containerNames, ", ")))
+
+		err := sendPodLogs(ctx, pod, containerNames)
+		if err != nil {
+			klog.Errorf("[processContainers] failed send pod logs: %s", err)
+			recordSendError(pod, err)
+			for _, containerStatus := range containerStatuses {
+				releaseTermination(pod, containerStatus)
+				releaseCooldown(pod, containerStatus.Name)
+				releaseCrash(pod, containerStatus)
+			}
+			result.errs = append(result.errs, err)
+			return result
+		}
+
+		result.sent += len(containerStatuses)
+		markPodNotified(pod)
+	}
+
+	return result
+}
+
+// processResult is result of processing of pod containers.
+type processResult struct {
+	// containers is number of containers matched by container patterns
+	containers int
+	// sent is number of containers which logs are sent
+	sent int
+	errs []error
 }
 
-func processPod(obj interface{}) {
+// err returns aggregate of send errors or nil.
+func (r processResult) err() error {
+	return utilerrors.NewAggregate(r.errs)
+}
+
+func processPod(ctx context.Context, obj interface{}) processResult {
 	pod := obj.(*v1.Pod)
 
 	podName := pod.GetName()
 
 	klog.Infof("Event from pod: %s", podName)
 
-	if isPodShouldCheck(podName, podNamePatterns) {
-		processContainers(pod)
+	if isNamespaceExcluded(pod.GetNamespace()) {
+		return processResult{}
+	}
+
+	if resolveSendConfig(pod, "").ignored {
+		return processResult{}
 	}
+
+	if isPodMatched(pod) && isWorkloadShouldCheck(pod) {
+		var failureErr error
+		if notifyPodFailures && pod.Status.Phase == v1.PodFailed {
+			failureErr = processPodFailure(ctx, pod)
+		}
+
+		processWaitingContainers(ctx, pod)
+		processRestartRates(ctx, pod)
+
+		result := processContainers(ctx, effectivePod(pod))
+		if failureErr != nil {
+			// failure is sent again on retry, it is not marked as notified
+			result.errs = append(result.errs, failureErr)
+		}
+
+		if onDelete && pod.GetDeletionTimestamp() != nil {
+			terminating := processTerminatingPod(ctx, pod)
+			result.sent += terminating.sent
+			result.errs = append(result.errs, terminating.errs...)
+		}
+		return result
+	}
+
+	return processResult{}
 }
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// recordingNotifier records names of containers which logs are sent,
+// their captions, sent messages and their pods.
+type recordingNotifier struct {
+	mu          sync.Mutex
+	containers  []string
+	captions    []string
+	logs        []string
+	messages    []string
+	messagePods []*v1.Pod
+	err         error
+}
+
+func (n *recordingNotifier) LogFormat() logFormat {
+	return logFormatRaw
+}
+
+func (n *recordingNotifier) SendLogs(ctx context.Context, notification *notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return n.err
+	}
+
+	n.containers = append(n.containers, notification.containerName)
+	n.captions = append(n.captions, notification.caption)
+	n.logs = append(n.logs, notification.logs.String())
+	return nil
+}
+
+func (n *recordingNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return n.err
+	}
+
+	n.messages = append(n.messages, text)
+	n.messagePods = append(n.messagePods, pod)
+	return nil
+}
+
+func (n *recordingNotifier) sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string(nil), n.containers...)
+}
+
+// setupTest replaces clientset, notifier and logs stream with fakes and
+// returns function which restores them and filters changed by tests.
+func setupTest(t *testing.T, objects ...runtime.Object) (*recordingNotifier, func()) {
+	t.Helper()
+
+	savedClientset, savedNotifier, savedOpenPodLogs := clientset, notifier, openPodLogs
+	savedDelay, savedNotifyOn := delay, notifyOn
+	savedPodNames, savedPodNamePatterns, savedContainerNamePatterns := podNames, podNamePatterns, containerNamePatterns
+	savedIncludeReasons, savedExcludeReasons := includeReasons, excludeReasons
+
+	recorder := &recordingNotifier{}
+	fakeClientset := fake.NewSimpleClientset(objects...)
+	clientset = fakeClientset
+	notifier = recorder
+	// fake clientset does not serve logs, but its reactors handle log
+	// request, so pods missing in clientset have no logs
+	openPodLogs = func(ctx context.Context, pod *v1.Pod, opts *v1.PodLogOptions) (io.ReadCloser, error) {
+		action := k8stesting.NewGetSubresourceAction(v1.SchemeGroupVersion.WithResource("pods"), pod.Namespace, "log", pod.Name)
+		if _, err := fakeClientset.Invokes(action, &v1.Pod{}); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader("log of " + opts.Container + "\n")), nil
+	}
+	delay = 60
+	notifyOn = notifyOnTerminated
+
+	return recorder, func() {
+		clientset, notifier, openPodLogs = savedClientset, savedNotifier, savedOpenPodLogs
+		delay, notifyOn = savedDelay, savedNotifyOn
+		podNames, podNamePatterns, containerNamePatterns = savedPodNames, savedPodNamePatterns, savedContainerNamePatterns
+		includeReasons, excludeReasons = savedIncludeReasons, savedExcludeReasons
+	}
+}
+
+// newTestPod returns pod with container statuses, uid is derived from
+// name, so state of different tests does not overlap.
+func newTestPod(namespace, name string, statuses ...v1.ContainerStatus) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			UID:       types.UID(namespace + "-" + name + "-uid"),
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodRunning,
+			ContainerStatuses: statuses,
+		},
+	}
+}
+
+// terminatedStatus returns status of container which ran a minute and
+// finished ago.
+func terminatedStatus(name, reason string, exitCode int32, ago time.Duration) v1.ContainerStatus {
+	finishedAt := time.Now().Add(-ago)
+
+	return v1.ContainerStatus{
+		Name:        name,
+		Image:       name + ":latest",
+		ContainerID: "containerd://" + name,
+		State: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{
+				Reason:     reason,
+				ExitCode:   exitCode,
+				StartedAt:  metav1.NewTime(finishedAt.Add(-time.Minute)),
+				FinishedAt: metav1.NewTime(finishedAt),
+			},
+		},
+	}
+}
+
+func runningStatus(name string) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:  name,
+		Image: name + ":latest",
+		State: v1.ContainerState{
+			Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()},
+		},
+	}
+}
+
+func TestProcessPod(t *testing.T) {
+	tests := []struct {
+		name                  string
+		pod                   *v1.Pod
+		podNames              []string
+		podNamePatterns       []string
+		containerNamePatterns []string
+		excludeReasons        []string
+		want                  []string
+	}{
+		{
+			name: "terminated within delay",
+			pod:  newTestPod("default", "within-delay", terminatedStatus("app", "Error", 1, 10*time.Second)),
+			want: []string{"app"},
+		},
+		{
+			name: "terminated out of delay",
+			pod:  newTestPod("default", "out-of-delay", terminatedStatus("app", "Error", 1, 5*time.Minute)),
+		},
+		{
+			name: "running container",
+			pod:  newTestPod("default", "running", runningStatus("app")),
+		},
+		{
+			name: "oom killed exit code",
+			pod:  newTestPod("default", "oom", terminatedStatus("app", "OOMKilled", 137, time.Second)),
+			want: []string{"app"},
+		},
+		{
+			name:           "successful exit code with excluded reason",
+			pod:            newTestPod("default", "completed", terminatedStatus("app", "Completed", 0, time.Second)),
+			excludeReasons: []string{"Completed"},
+		},
+		{
+			name: "only terminated containers of pod",
+			pod: newTestPod("default", "mixed",
+				runningStatus("sidecar"),
+				terminatedStatus("app", "Error", 2, time.Second),
+				terminatedStatus("old", "Error", 2, time.Hour)),
+			want: []string{"app"},
+		},
+		{
+			name:     "pod name matched",
+			pod:      newTestPod("default", "api", terminatedStatus("app", "Error", 1, time.Second)),
+			podNames: []string{"worker", "api"},
+			want:     []string{"app"},
+		},
+		{
+			name:            "pod name not matched",
+			pod:             newTestPod("default", "web", terminatedStatus("app", "Error", 1, time.Second)),
+			podNamePatterns: []string{"^api-"},
+		},
+		{
+			name:            "pod pattern matched",
+			pod:             newTestPod("default", "api-7d9c", terminatedStatus("app", "Error", 1, time.Second)),
+			podNamePatterns: []string{"^api-"},
+			want:            []string{"app"},
+		},
+		{
+			name: "container name matched",
+			pod: newTestPod("default", "containers",
+				terminatedStatus("app", "Error", 1, time.Second),
+				terminatedStatus("init", "Error", 1, time.Second)),
+			containerNamePatterns: []string{"app"},
+			want:                  []string{"app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, restore := setupTest(t, tt.pod)
+			defer restore()
+
+			podNames = tt.podNames
+			podNamePatterns = tt.podNamePatterns
+			containerNamePatterns = tt.containerNamePatterns
+			excludeReasons = tt.excludeReasons
+
+			result := processPod(context.Background(), tt.pod)
+			if err := result.err(); err != nil {
+				t.Fatalf("processPod() error = %v", err)
+			}
+
+			if got := recorder.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent containers = %v, want %v", got, tt.want)
+			}
+			if result.sent != len(tt.want) {
+				t.Errorf("result.sent = %d, want %d", result.sent, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestProcessPodSendsOnce(t *testing.T) {
+	pod := newTestPod("default", "send-once", terminatedStatus("app", "Error", 1, time.Second))
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	processPod(context.Background(), pod)
+	processPod(context.Background(), pod.DeepCopy())
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+}
+
+func TestProcessPodReleasesFailedSend(t *testing.T) {
+	pod := newTestPod("default", "failed-send", terminatedStatus("app", "Error", 1, time.Second))
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	recorder.err = context.DeadlineExceeded
+	if err := processPod(context.Background(), pod).err(); err == nil {
+		t.Fatal("processPod() error = nil, want send error")
+	}
+
+	recorder.err = nil
+	if err := processPod(context.Background(), pod).err(); err != nil {
+		t.Fatalf("processPod() error = %v on retry", err)
+	}
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+}
+
+func TestProcessPodReleasesFailedCoalescedSend(t *testing.T) {
+	pod := newTestPod("default", "failed-coalesced-send", terminatedStatus("app", "Error", 1, time.Second))
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	savedCoalesceWindow := coalesceWindow
+	defer func() {
+		coalesceWindow = savedCoalesceWindow
+	}()
+	coalesceWindow = time.Hour
+
+	recorder.err = context.DeadlineExceeded
+	if err := processPod(context.Background(), pod).err(); err == nil {
+		t.Fatal("processPod() error = nil, want send error")
+	}
+
+	recorder.err = nil
+	if err := processPod(context.Background(), pod).err(); err != nil {
+		t.Fatalf("processPod() error = %v on retry", err)
+	}
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	pods := []runtime.Object{
+		newTestPod("sync", "crashed", terminatedStatus("app", "Error", 1, time.Second)),
+		newTestPod("sync", "healthy", runningStatus("app")),
+	}
+
+	recorder, restore := setupTest(t, pods...)
+	defer restore()
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	c := NewController(queue, nil)
+	factory, informer := newPodInformer("sync", queue, func(error) {})
+	c.podInformers["sync"] = &podInformer{factory: factory, informer: informer}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+		t.Fatal("timed out waiting for caches to sync")
+	}
+
+	for _, key := range []string{"sync/crashed", "sync/healthy", "sync/deleted"} {
+		if err := c.syncState(context.Background(), key); err != nil {
+			t.Fatalf("syncState(%s) error = %v", key, err)
+		}
+	}
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+	if got := recorder.logs; len(got) != 1 || got[0] != "log of app\n" {
+		t.Errorf("sent logs = %q, want [\"log of app\\n\"]", got)
+	}
+}
+
+func TestIsContainerLogShouldSendedReasons(t *testing.T) {
+	tests := []struct {
+		name           string
+		includeReasons []string
+		excludeReasons []string
+		want           map[string]bool
+	}{
+		{
+			name: "no reasons",
+			want: map[string]bool{"Error": true, "OOMKilled": true, "Completed": true},
+		},
+		{
+			name:           "include only",
+			includeReasons: []string{"Error", "OOMKilled"},
+			want:           map[string]bool{"Error": true, "OOMKilled": true, "Completed": false},
+		},
+		{
+			name:           "exclude only",
+			excludeReasons: []string{"Completed"},
+			want:           map[string]bool{"Error": true, "OOMKilled": true, "Completed": false},
+		},
+		{
+			name:           "include and exclude",
+			includeReasons: []string{"Error", "Completed"},
+			excludeReasons: []string{"Completed"},
+			want:           map[string]bool{"Error": true, "OOMKilled": false, "Completed": false},
+		},
+		{
+			name:           "exclude wins over include",
+			includeReasons: []string{"Error"},
+			excludeReasons: []string{"Error"},
+			want:           map[string]bool{"Error": false, "OOMKilled": false, "Completed": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedDelay, savedIncludeReasons, savedExcludeReasons := delay, includeReasons, excludeReasons
+			defer func() {
+				delay, includeReasons, excludeReasons = savedDelay, savedIncludeReasons, savedExcludeReasons
+			}()
+
+			delay = 60
+			includeReasons = tt.includeReasons
+			excludeReasons = tt.excludeReasons
+
+			for reason, want := range tt.want {
+				status := terminatedStatus("app", reason, 1, time.Second)
+				if got := isContainerLogShouldSended(status); got != want {
+					t.Errorf("isContainerLogShouldSended() with reason %s = %t, want %t", reason, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsNamespaceExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		excludes []string
+		want     map[string]bool
+	}{
+		{
+			name: "no excludes",
+			want: map[string]bool{"kube-system": false, "default": false},
+		},
+		{
+			name:     "system namespaces by prefix",
+			excludes: []string{"^kube-"},
+			want: map[string]bool{
+				"kube-system":     true,
+				"kube-public":     true,
+				"kube-node-lease": true,
+				"default":         false,
+				"my-kube-app":     false,
+			},
+		},
+		{
+			name:     "exact names",
+			excludes: []string{"^kube-system$", "^default$"},
+			want: map[string]bool{
+				"kube-system": true,
+				"kube-public": false,
+				"default":     true,
+				"default-dev": false,
+			},
+		},
+		{
+			name:     "unanchored pattern",
+			excludes: []string{"system"},
+			want: map[string]bool{
+				"kube-system":       true,
+				"cattle-system":     true,
+				"gatekeeper-system": true,
+				"payments":          false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := namespaceExcludeRegexps
+			defer func() {
+				namespaceExcludeRegexps = saved
+			}()
+
+			namespaceExcludeRegexps = nil
+			for _, pattern := range tt.excludes {
+				namespaceExcludeRegexps = append(namespaceExcludeRegexps, regexp.MustCompile(pattern))
+			}
+
+			for namespace, want := range tt.want {
+				if got := isNamespaceExcluded(namespace); got != want {
+					t.Errorf("isNamespaceExcluded(%s) = %t, want %t", namespace, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessPodNamespaceExcluded(t *testing.T) {
+	system := newTestPod("kube-system", "coredns", terminatedStatus("coredns", "Error", 1, time.Second))
+	app := newTestPod("default", "excluded-check", terminatedStatus("app", "Error", 1, time.Second))
+
+	recorder, restore := setupTest(t, system, app)
+	defer restore()
+
+	saved := namespaceExcludeRegexps
+	defer func() {
+		namespaceExcludeRegexps = saved
+	}()
+	namespaceExcludeRegexps = []*regexp.Regexp{regexp.MustCompile("^kube-")}
+
+	processPod(context.Background(), system)
+	processPod(context.Background(), app)
+
+	if got := recorder.sent(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("sent containers = %v, want [app]", got)
+	}
+}
+
+func TestIsContainerLogShouldSendedZeroTimestamps(t *testing.T) {
+	now := metav1.Now()
+
+	tests := []struct {
+		name       string
+		startedAt  metav1.Time
+		finishedAt metav1.Time
+		want       bool
+	}{
+		{name: "valid timestamps", startedAt: metav1.NewTime(now.Add(-time.Minute)), finishedAt: now, want: true},
+		{name: "zero startedAt", finishedAt: now},
+		{name: "zero finishedAt", startedAt: metav1.NewTime(now.Add(-time.Minute))},
+		{name: "both zero"},
+		{name: "equal timestamps", startedAt: now, finishedAt: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedDelay := delay
+			defer func() {
+				delay = savedDelay
+			}()
+			delay = 60
+
+			status := terminatedStatus("app", "Error", 1, 0)
+			status.State.Terminated.StartedAt = tt.startedAt
+			status.State.Terminated.FinishedAt = tt.finishedAt
+
+			if got := isContainerLogShouldSended(status); got != tt.want {
+				t.Errorf("isContainerLogShouldSended() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendContainerLogsNotFound(t *testing.T) {
+	tests := []struct {
+		name    string
+		seed    bool
+		reactor bool
+	}{
+		{name: "pod disappeared"},
+		{name: "container logs not found", seed: true, reactor: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTestPod("default", "not-found", terminatedStatus("app", "Error", 1, time.Second))
+
+			var objects []runtime.Object
+			if tt.seed {
+				objects = append(objects, pod)
+			}
+
+			recorder, restore := setupTest(t, objects...)
+			defer restore()
+
+			if tt.reactor {
+				clientset.(*fake.Clientset).PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "log" {
+						return false, nil, nil
+					}
+					return true, nil, apierrors.NewNotFound(v1.Resource("pods/log"), pod.GetName())
+				})
+			}
+
+			if err := sendContainerLogs(context.Background(), pod, "app", false); err != nil {
+				t.Fatalf("sendContainerLogs() error = %v, want nil for not found logs", err)
+			}
+			if got := recorder.sent(); len(got) != 0 {
+				t.Errorf("sent containers = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestSendPodLogsCaption(t *testing.T) {
+	pod := newTestPod("default", "caption",
+		terminatedStatus("app", "Error", 1, 10*time.Second),
+		terminatedStatus("sidecar", "OOMKilled", 137, 10*time.Second),
+	)
+	pod.Spec.NodeName = "node-1"
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	savedCaptionTemplate, savedNodeLogLink := captionTemplate, nodeLogLink
+	defer func() {
+		captionTemplate, nodeLogLink = savedCaptionTemplate, savedNodeLogLink
+	}()
+
+	var err error
+	captionTemplate, err = parseTemplate("caption", "{{.Pod}}/{{.Container}}: {{.Reason}}", captionData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeLogLink, err = parseTemplate("node log link", "https://logs/{{.Node}}", nodeLogLinkData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sendPodLogs(context.Background(), pod, []string{"app", "sidecar"}); err != nil {
+		t.Fatalf("sendPodLogs() error = %v", err)
+	}
+
+	want := "caption/app: Error\ncaption/sidecar: OOMKilled\nlogs: https://logs/node-1"
+	if len(recorder.captions) != 1 || recorder.captions[0] != want {
+		t.Errorf("captions = %q, want [%q]", recorder.captions, want)
+	}
+}
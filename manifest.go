@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type podManifest struct {
+	Pod    *v1.Pod    `json:"pod"`
+	Events []v1.Event `json:"events"`
+}
+
+// lastAppliedAnnotation holds manifest applied by kubectl, env values are
+// in it too
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// redactPod masks env values of pod containers and drops last applied
+// manifest if redaction is enabled, other secrets are masked by patterns
+// in marshaled manifest.
+func redactPod(pod *v1.Pod) *v1.Pod {
+	if len(redactions) == 0 {
+		return pod
+	}
+
+	redactEnv := func(env []v1.EnvVar) {
+		for i := range env {
+			if len(env[i].Value) > 0 {
+				env[i].Value = "***"
+			}
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		redactEnv(pod.Spec.InitContainers[i].Env)
+	}
+	for i := range pod.Spec.Containers {
+		redactEnv(pod.Spec.Containers[i].Env)
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		redactEnv(pod.Spec.EphemeralContainers[i].Env)
+	}
+
+	delete(pod.Annotations, lastAppliedAnnotation)
+
+	return pod
+}
+
+// sendPodManifest sends pod spec, status and events as json document.
+func sendPodManifest(ctx context.Context, pod *v1.Pod) error {
+	events, err := getPodEvents(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("[sendPodManifest] failed get pod events: %s", err)
+	}
+
+	// managed fields are noise for responders
+	p := pod.DeepCopy()
+	p.ManagedFields = nil
+
+	data, err := json.MarshalIndent(podManifest{Pod: redactPod(p), Events: events}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("[sendPodManifest] failed marshal pod manifest: %s", err)
+	}
+
+	err = sendNotification(ctx, &notification{
+		pod:       pod,
+		name:      notificationName(pod, "") + "_manifest",
+		extension: "json",
+		caption:   fmt.Sprintf("manifest of pod %s/%s", pod.GetNamespace(), pod.GetName()),
+		logs:      redactLogs(bytes.NewBuffer(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("[sendPodManifest] failed send pod manifest: %s", err)
+	}
+
+	return nil
+}
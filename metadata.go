@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// maxTerminationMessageLen limits termination message in caption, full
+// message may be up to 4096 bytes
+const maxTerminationMessageLen = 300
+
+var signalNames = map[int32]string{
+	1:  "SIGHUP",
+	2:  "SIGINT",
+	3:  "SIGQUIT",
+	4:  "SIGILL",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	9:  "SIGKILL",
+	11: "SIGSEGV",
+	13: "SIGPIPE",
+	15: "SIGTERM",
+}
+
+// terminationSignal returns signal which killed container, it is guessed
+// from exit code greater than 128 if signal is not reported.
+func terminationSignal(terminated *v1.ContainerStateTerminated) string {
+	signal := terminated.Signal
+	if signal == 0 && terminated.ExitCode > 128 {
+		signal = terminated.ExitCode - 128
+	}
+
+	if signal == 0 {
+		return ""
+	}
+
+	if name, ok := signalNames[signal]; ok {
+		return fmt.Sprintf("%d (%s)", signal, name)
+	}
+
+	return fmt.Sprintf("%d", signal)
+}
+
+// findContainerStatus returns status of pod container by name or nil.
+func findContainerStatus(pod *v1.Pod, containerName string) *v1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == containerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+
+	return nil
+}
+
+func containerTerminationReason(pod *v1.Pod, containerName string) string {
+	containerStatus := findContainerStatus(pod, containerName)
+	if containerStatus == nil || containerStatus.State.Terminated == nil {
+		return ""
+	}
+
+	return containerStatus.State.Terminated.Reason
+}
+
+// writeContainerMetadata writes container termination and image details.
+func writeContainerMetadata(b *strings.Builder, containerStatus *v1.ContainerStatus) {
+	fmt.Fprintf(b, "container: %s\n", containerStatus.Name)
+
+	if terminated := containerStatus.State.Terminated; terminated != nil {
+		fmt.Fprintf(b, "reason: %s, exit code: %d\n", terminated.Reason, terminated.ExitCode)
+		if signal := terminationSignal(terminated); len(signal) > 0 {
+			fmt.Fprintf(b, "signal: %s\n", signal)
+		}
+		if message := strings.TrimSpace(terminated.Message); len(message) > 0 {
+			fmt.Fprintf(b, "message: %s\n", truncateText(redactText(message), maxTerminationMessageLen))
+		}
+	}
+
+	fmt.Fprintf(b, "image: %s\n", containerStatus.Image)
+	if len(containerStatus.ImageID) > 0 {
+		fmt.Fprintf(b, "image id: %s\n", containerStatus.ImageID)
+	}
+}
+
+// findContainerSpec returns spec of pod container by name or nil.
+func findContainerSpec(pod *v1.Pod, containerName string) *v1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+// formatResourceList returns resources sorted by name, e.g.
+// cpu=100m, memory=128Mi.
+func formatResourceList(resources v1.ResourceList) string {
+	items := make([]string, 0, len(resources))
+	for name, quantity := range resources {
+		items = append(items, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	sort.Strings(items)
+
+	return strings.Join(items, ", ")
+}
+
+// writeContainerResources writes requests and limits of container killed
+// by OOM, they show whether memory limit is too low.
+func writeContainerResources(b *strings.Builder, pod *v1.Pod, containerStatus *v1.ContainerStatus) {
+	terminated := containerStatus.State.Terminated
+	if terminated == nil || terminated.Reason != "OOMKilled" {
+		return
+	}
+
+	container := findContainerSpec(pod, containerStatus.Name)
+	if container == nil {
+		return
+	}
+
+	if len(container.Resources.Requests) > 0 {
+		fmt.Fprintf(b, "requests: %s\n", formatResourceList(container.Resources.Requests))
+	}
+	if len(container.Resources.Limits) > 0 {
+		fmt.Fprintf(b, "limits: %s\n", formatResourceList(container.Resources.Limits))
+	} else {
+		fmt.Fprintf(b, "limits: none\n")
+	}
+}
+
+// buildCaption returns metadata header of pod containers logs.
+func buildCaption(pod *v1.Pod, containerNames ...string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "namespace: %s\n", pod.GetNamespace())
+	fmt.Fprintf(&b, "pod: %s\n", pod.GetName())
+
+	for _, containerName := range containerNames {
+		containerStatus := findContainerStatus(pod, containerName)
+		if containerStatus == nil {
+			fmt.Fprintf(&b, "container: %s\n", containerName)
+			continue
+		}
+
+		writeContainerMetadata(&b, containerStatus)
+		if includeOOMResources {
+			writeContainerResources(&b, pod, containerStatus)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newNamespaceInformer returns informer of namespaces matched by label
+// selector which starts and stops watching pods in them.
+func newNamespaceInformer(c *Controller, selector string) cache.Controller {
+	// label selector must not be applied to other informers of factory,
+	// so namespaces informer is built with own list and watch
+	informer := c.factory.InformerFor(&v1.Namespace{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		namespaceListWatcher := cache.NewFilteredListWatchFromClient(client.CoreV1().RESTClient(), "namespaces", metav1.NamespaceAll, func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		})
+
+		return cache.NewSharedIndexInformer(namespaceListWatcher, &v1.Namespace{}, 0, cache.Indexers{})
+	})
+
+	// Namespaces which lose the label are delivered as deleted by filtered watch.
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*v1.Namespace); ok {
+				c.AddNamespace(ns.GetName())
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if ns, ok := obj.(*v1.Namespace); ok {
+				c.RemoveNamespace(ns.GetName())
+			}
+		},
+	})
+
+	return informer
+}
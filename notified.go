@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+var (
+	notifiedPodsMu sync.Mutex
+	// notifiedPods holds uid of pods which logs are already sent by pod key
+	notifiedPods = map[string]types.UID{}
+)
+
+// isPodNotified reports whether logs of pod were sent with --once-per-pod.
+func isPodNotified(pod *v1.Pod) bool {
+	if !oncePerPod {
+		return false
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	notifiedPodsMu.Lock()
+	notified := notifiedPods[key] == pod.GetUID()
+	notifiedPodsMu.Unlock()
+
+	if notified {
+		klog.V(4).Infof("Pod %s is skipped, logs are already sent once", pod.GetName())
+	}
+
+	return notified
+}
+
+// markPodNotified marks pod as notified, so its logs are not sent again
+// with --once-per-pod.
+func markPodNotified(pod *v1.Pod) {
+	if !oncePerPod {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	notifiedPodsMu.Lock()
+	notifiedPods[key] = pod.GetUID()
+	notifiedPodsMu.Unlock()
+}
+
+// forgetPodNotified removes deleted pod from notified pods.
+func forgetPodNotified(key string) {
+	notifiedPodsMu.Lock()
+	delete(notifiedPods, key)
+	notifiedPodsMu.Unlock()
+}
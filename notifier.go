@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// notification holds container logs prepared for sending.
+type notification struct {
+	pod           *v1.Pod
+	containerName string
+	// name is used as base of sent log file name
+	name string
+	// extension of sent file, "log" is used if empty
+	extension string
+	// reason of container termination, may be empty
+	reason string
+	// caption is human readable metadata header of logs
+	caption string
+	logs    *bytes.Buffer
+}
+
+// logFormat is representation of logs expected by notifier.
+type logFormat int
+
+const (
+	// logFormatRaw passes logs as is, notifier formats them itself
+	logFormatRaw logFormat = iota
+	// logFormatText passes caption and logs as single text
+	logFormatText
+	// logFormatJSON passes logs and metadata as json envelope
+	logFormatJSON
+)
+
+// logEnvelope is json representation of notification.
+type logEnvelope struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Caption   string `json:"caption,omitempty"`
+	Logs      string `json:"logs"`
+}
+
+// logLimiter is implemented by notifiers which reject large logs, logs are
+// truncated before formatting, so json envelope stays valid.
+type logLimiter interface {
+	// MaxLogBytes returns max size of logs passed to formatting.
+	MaxLogBytes() int
+}
+
+// formatNotification converts logs of notification to format declared by
+// notifier, caption is moved to logs for text and json formats.
+func formatNotification(n *notification, to Notifier) (*notification, error) {
+	formatted := *n
+
+	logs := n.logs
+	if l, ok := to.(logLimiter); ok {
+		logs = truncateLogs(logs, l.MaxLogBytes())
+	}
+	formatted.logs = logs
+
+	switch to.LogFormat() {
+	case logFormatText:
+		buf := new(bytes.Buffer)
+		if len(n.caption) > 0 {
+			fmt.Fprintf(buf, "%s\n\n", n.caption)
+		}
+		buf.Write(logs.Bytes())
+		formatted.caption = ""
+		formatted.logs = buf
+		formatted.extension = "txt"
+	case logFormatJSON:
+		envelope := logEnvelope{
+			Container: n.containerName,
+			Reason:    n.reason,
+			Caption:   n.caption,
+			Logs:      logs.String(),
+		}
+		if n.pod != nil {
+			envelope.Namespace = n.pod.GetNamespace()
+			envelope.Pod = n.pod.GetName()
+		}
+
+		b, err := json.Marshal(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("[formatNotification] failed marshal logs: %s", err)
+		}
+		formatted.caption = ""
+		formatted.logs = bytes.NewBuffer(b)
+		formatted.extension = "json"
+	}
+
+	return &formatted, nil
+}
+
+// sendNotification sends logs formatted as notifier expects, logs are
+// held during quiet hours.
+func sendNotification(ctx context.Context, n *notification) error {
+	if holdQuiet(n) {
+		return nil
+	}
+
+	return deliverNotification(ctx, n)
+}
+
+// deliverNotification sends logs regardless of quiet hours.
+func deliverNotification(ctx context.Context, n *notification) error {
+	formatted, err := formatNotification(n, notifier)
+	if err != nil {
+		return err
+	}
+
+	// logs buffer may be consumed by notifier
+	size := formatted.logs.Len()
+
+	if sendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+
+	// raw logs are kept for dead letter, notifier may consume buffer
+	logs := n.logs.Bytes()
+
+	err = notifier.SendLogs(ctx, formatted)
+	writeAudit(n, size, err)
+
+	if err != nil && len(deadLetterDir) > 0 && isFinalAttempt(ctx) {
+		writeDeadLetter(n, logs, err)
+	}
+
+	return err
+}
+
+// sendMessage sends text message related to pod and records it to audit
+// log, pod may be nil for messages not related to any pod.
+func sendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	err := notifier.SendMessage(ctx, pod, text)
+	writeAuditMessage(pod, text, err)
+
+	return err
+}
+
+// Notifier delivers logs and messages to destination.
+type Notifier interface {
+	// LogFormat returns representation of logs passed to SendLogs.
+	LogFormat() logFormat
+	// SendLogs sends logs from notification as file.
+	SendLogs(ctx context.Context, n *notification) error
+	// SendMessage sends text message related to pod, pod may be nil for
+	// messages not related to any pod.
+	SendMessage(ctx context.Context, pod *v1.Pod, text string) error
+}
+
+// file names longer than 255 bytes are rejected by most file systems,
+// timestamp and extension are appended to name
+const maxFileNameLen = 200
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sanitizeFileName replaces characters not allowed in sent document names,
+// leading dots are removed, so name is never hidden or relative.
+func sanitizeFileName(name string) string {
+	name = strings.TrimLeft(unsafeFileNameChars.ReplaceAllString(name, "_"), ".")
+	if len(name) > maxFileNameLen {
+		name = name[:maxFileNameLen]
+	}
+
+	return name
+}
+
+// notificationName returns file name prefix for pod logs rendered by
+// --filename-template, container name may be empty for logs of whole pod.
+func notificationName(pod *v1.Pod, containerName string) string {
+	name := templateFileName(pod, containerName)
+	if len(name) == 0 {
+		name = fmt.Sprintf("%s_%s", pod.GetNamespace(), pod.GetName())
+		if len(containerName) > 0 {
+			name = fmt.Sprintf("%s_%s", name, containerName)
+		}
+	}
+
+	if nameWithUID {
+		uid := string(pod.GetUID())
+		if len(uid) > 8 {
+			uid = uid[:8]
+		}
+		name = fmt.Sprintf("%s_%s", name, uid)
+	}
+
+	return sanitizeFileName(name)
+}
+
+// fileName returns name of file sent with notification.
+func (n *notification) fileName() string {
+	extension := n.extension
+	if len(extension) == 0 {
+		extension = "log"
+	}
+
+	return fmt.Sprintf("%s_%d.%s", n.name, time.Now().Unix(), extension)
+}
+
+// notifierTransport is used by http clients of notifiers, it honors
+// HTTPS_PROXY and similar env vars unless --proxy-url is set.
+var notifierTransport http.RoundTripper = http.DefaultTransport
+
+// newNotifierTransport returns transport which sends requests through proxy,
+// http, https and socks5 proxy schemes are supported.
+func newNotifierTransport(proxyURL string) (http.RoundTripper, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("[newNotifierTransport] failed parse proxy url: %s", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("[newNotifierTransport] unsupported proxy scheme %q", u.Scheme)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+
+	return transport, nil
+}
+
+// newNotifiers returns notifier which sends to every named notifier.
+func newNotifiers(names []string) (Notifier, error) {
+	if len(proxyURL) > 0 {
+		transport, err := newNotifierTransport(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		notifierTransport = transport
+	}
+
+	if len(names) == 1 {
+		return newNotifier(names[0])
+	}
+
+	var m multiNotifier
+	for _, name := range names {
+		n, err := newNotifier(name)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, n)
+	}
+
+	return m, nil
+}
+
+// usesNotifier reports whether named notifier is configured.
+func usesNotifier(name string) bool {
+	for _, n := range notifierNames {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newNotifier returns notifier by name.
+func newNotifier(name string) (Notifier, error) {
+	switch name {
+	case "telegram":
+		switch telegramParseMode {
+		case "", "MarkdownV2", "HTML":
+		default:
+			return nil, fmt.Errorf("[newNotifier] unknown telegram parse mode %q", telegramParseMode)
+		}
+		if telegramAPIURL != defaultTelegramAPIURL {
+			u, err := url.Parse(telegramAPIURL)
+			if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+				return nil, fmt.Errorf("[newNotifier] invalid telegram api url %q", telegramAPIURL)
+			}
+			telegramAPIBase = u
+		}
+		return &telegramNotifier{}, nil
+	case "discord":
+		if len(discordWebhookURL) == 0 {
+			return nil, fmt.Errorf("[newNotifier] discord notifier requires --discord-webhook-url")
+		}
+		return &discordNotifier{webhookURL: discordWebhookURL}, nil
+	case "teams":
+		if len(teamsWebhookURL) == 0 {
+			return nil, fmt.Errorf("[newNotifier] teams notifier requires --teams-webhook-url")
+		}
+		return &teamsNotifier{webhookURL: teamsWebhookURL}, nil
+	case "sentry":
+		if len(sentryDSN) == 0 {
+			return nil, fmt.Errorf("[newNotifier] sentry notifier requires --sentry-dsn")
+		}
+		return newSentryNotifier(sentryDSN)
+	case "kafka":
+		if len(kafkaBrokers) == 0 || len(kafkaTopic) == 0 {
+			return nil, fmt.Errorf("[newNotifier] kafka notifier requires --kafka-brokers and --kafka-topic")
+		}
+		return &kafkaNotifier{brokers: kafkaBrokers, topic: kafkaTopic, tls: kafkaTLS}, nil
+	case "smtp":
+		if len(smtpHost) == 0 || len(smtpFrom) == 0 || len(smtpTo) == 0 {
+			return nil, fmt.Errorf("[newNotifier] smtp notifier requires --smtp-host, --smtp-from and --smtp-to")
+		}
+		return &smtpNotifier{host: smtpHost, from: smtpFrom, to: smtpTo}, nil
+	}
+
+	return nil, fmt.Errorf("[newNotifier] unknown notifier %q", name)
+}
+
+// multiNotifier sends to several notifiers concurrently, failure of one
+// notifier doesn't prevent sending to others.
+type multiNotifier []Notifier
+
+// deliveryTTL limits how long partial deliveries are remembered, retries
+// of pod end much earlier
+const deliveryTTL = time.Hour
+
+// partialDelivery holds indexes of notifiers which received notification
+// failed for other notifiers.
+type partialDelivery struct {
+	at        time.Time
+	delivered map[int]bool
+}
+
+var (
+	partialDeliveriesMu sync.Mutex
+	// partialDeliveries are keyed by notification key, so retry of
+	// notification is sent only to notifiers which failed
+	partialDeliveries = map[string]*partialDelivery{}
+)
+
+// deliveryKey returns key of pod notification, logs of the same container
+// termination have the same key. Empty key is returned for notifications
+// not related to pod, they are sent to all notifiers on retry.
+func deliveryKey(pod *v1.Pod, parts ...string) string {
+	if pod == nil {
+		return ""
+	}
+
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return fmt.Sprintf("%s/%x", pod.GetUID(), h.Sum64())
+}
+
+// notificationKey returns delivery key of logs notification. Key includes
+// restart count and termination time of notified containers, all pod
+// containers for whole pod notification, so every crash has own key.
+func notificationKey(n *notification) string {
+	parts := []string{"logs", n.name, n.containerName}
+	if n.pod != nil {
+		for _, status := range n.pod.Status.ContainerStatuses {
+			if len(n.containerName) > 0 && status.Name != n.containerName {
+				continue
+			}
+
+			parts = append(parts, status.Name, strconv.Itoa(int(status.RestartCount)))
+			if status.State.Terminated != nil {
+				parts = append(parts, status.State.Terminated.FinishedAt.String())
+			}
+		}
+	}
+
+	return deliveryKey(n.pod, parts...)
+}
+
+// delivered returns indexes of notifiers which already received
+// notification with key.
+func delivered(key string) map[int]bool {
+	partialDeliveriesMu.Lock()
+	defer partialDeliveriesMu.Unlock()
+
+	d, ok := partialDeliveries[key]
+	if !ok || time.Since(d.at) > deliveryTTL {
+		return nil
+	}
+
+	done := make(map[int]bool, len(d.delivered))
+	for i := range d.delivered {
+		done[i] = true
+	}
+
+	return done
+}
+
+// rememberDelivery saves notifiers which received notification with key,
+// key is forgotten when all notifiers received it. Expired deliveries are
+// removed.
+func rememberDelivery(key string, done map[int]bool, all int) {
+	partialDeliveriesMu.Lock()
+	defer partialDeliveriesMu.Unlock()
+
+	for k, d := range partialDeliveries {
+		if time.Since(d.at) > deliveryTTL {
+			delete(partialDeliveries, k)
+		}
+	}
+
+	if len(done) == all {
+		delete(partialDeliveries, key)
+		return
+	}
+
+	partialDeliveries[key] = &partialDelivery{at: time.Now(), delivered: done}
+}
+
+func (m multiNotifier) LogFormat() logFormat {
+	return logFormatRaw
+}
+
+// fanOut calls send for every notifier concurrently and returns aggregate
+// of their errors. Notifiers which already received notification with the
+// same key are skipped, so retry doesn't duplicate it.
+func (m multiNotifier) fanOut(key string, send func(Notifier) error) error {
+	done := delivered(key)
+	if done == nil {
+		done = map[int]bool{}
+	}
+
+	errs := make([]error, len(m))
+
+	var wg sync.WaitGroup
+	for i, n := range m {
+		if done[i] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			errs[i] = send(n)
+		}(i, n)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			done[i] = true
+		}
+	}
+
+	if len(key) > 0 {
+		rememberDelivery(key, done, len(m))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// SendLogs formats logs for every notifier, logs are fetched once and
+// every notifier reads own copy of buffer.
+func (m multiNotifier) SendLogs(ctx context.Context, n *notification) error {
+	return m.fanOut(notificationKey(n), func(notifier Notifier) error {
+		copied := *n
+		copied.logs = bytes.NewBuffer(n.logs.Bytes())
+
+		formatted, err := formatNotification(&copied, notifier)
+		if err != nil {
+			return err
+		}
+
+		return notifier.SendLogs(ctx, formatted)
+	})
+}
+
+func (m multiNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	return m.fanOut(deliveryKey(pod, "message", text), func(notifier Notifier) error {
+		return notifier.SendMessage(ctx, pod, text)
+	})
+}
+
+type telegramNotifier struct{}
+
+func (t *telegramNotifier) LogFormat() logFormat {
+	return logFormatRaw
+}
+
+func (t *telegramNotifier) SendLogs(ctx context.Context, n *notification) error {
+	return sendLogsToTelegram(ctx, resolveDestination(n.pod, n.containerName), n.logs, n.fileName(), n.caption, notificationKey(n))
+}
+
+func (t *telegramNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	return sendMessageToTelegram(ctx, resolveDestination(pod, ""), text)
+}
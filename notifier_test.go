@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "safe", in: "default_api-7d9c_app", want: "default_api-7d9c_app"},
+		{name: "path separators", in: "default/api/app", want: "default_api_app"},
+		{name: "spaces and unicode", in: "logs of под №1", want: "logs_of_1"},
+		{name: "leading dots", in: "../../etc/passwd", want: "_.._etc_passwd"},
+		{name: "hidden file", in: ".env", want: "env"},
+		{name: "only dots", in: "..", want: ""},
+		{name: "too long", in: strings.Repeat("a", maxFileNameLen+10), want: strings.Repeat("a", maxFileNameLen)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFileName(tt.in); got != tt.want {
+				t.Errorf("sanitizeFileName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationName(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "api-7d9c",
+			UID:       "0123456789abcdef",
+		},
+	}
+
+	tests := []struct {
+		name          string
+		containerName string
+		template      string
+		withUID       bool
+		want          string
+	}{
+		{name: "container", containerName: "app", want: "default_api-7d9c_app"},
+		{name: "whole pod", want: "default_api-7d9c"},
+		{name: "with uid", containerName: "app", withUID: true, want: "default_api-7d9c_app_01234567"},
+		{name: "template", containerName: "app", template: "{{.Pod}}-{{.Container}}", want: "api-7d9c-app"},
+		{name: "template with unsafe chars", containerName: "app", template: "{{.Namespace}}/{{.Pod}}", want: "default_api-7d9c"},
+		{name: "empty template output", containerName: "app", template: "{{if false}}x{{end}}", want: "default_api-7d9c_app"},
+		{name: "template with uid", containerName: "app", template: "{{.Pod}}", withUID: true, want: "api-7d9c_01234567"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedTemplate, savedWithUID := fileNameTemplate, nameWithUID
+			defer func() {
+				fileNameTemplate, nameWithUID = savedTemplate, savedWithUID
+			}()
+
+			fileNameTemplate = nil
+			if len(tt.template) > 0 {
+				fileNameTemplate = template.Must(parseTemplate("filename", tt.template, captionData{}))
+			}
+			nameWithUID = tt.withUID
+
+			if got := notificationName(pod, tt.containerName); got != tt.want {
+				t.Errorf("notificationName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// formatNotifier declares log format and limit for formatNotification.
+type formatNotifier struct {
+	recordingNotifier
+	format logFormat
+	max    int
+}
+
+func (n *formatNotifier) LogFormat() logFormat {
+	return n.format
+}
+
+func (n *formatNotifier) MaxLogBytes() int {
+	return n.max
+}
+
+func TestFormatNotification(t *testing.T) {
+	pod := newTestPod("default", "format")
+	newNotification := func() *notification {
+		return &notification{
+			pod:           pod,
+			containerName: "app",
+			name:          "default_format_app",
+			reason:        "Error",
+			caption:       "container: app",
+			logs:          bytes.NewBufferString("first\nsecond\n"),
+		}
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		got, err := formatNotification(newNotification(), &recordingNotifier{})
+		if err != nil {
+			t.Fatalf("formatNotification() error = %v", err)
+		}
+		if got.caption != "container: app" || got.logs.String() != "first\nsecond\n" || len(got.extension) > 0 {
+			t.Errorf("formatNotification() = %+v, want notification as is", got)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		got, err := formatNotification(newNotification(), &formatNotifier{format: logFormatText})
+		if err != nil {
+			t.Fatalf("formatNotification() error = %v", err)
+		}
+		if got.caption != "" || got.logs.String() != "container: app\n\nfirst\nsecond\n" || got.extension != "txt" {
+			t.Errorf("formatNotification() = %+v, want caption moved to logs", got)
+		}
+	})
+
+	t.Run("json with limit", func(t *testing.T) {
+		got, err := formatNotification(newNotification(), &formatNotifier{format: logFormatJSON, max: 7})
+		if err != nil {
+			t.Fatalf("formatNotification() error = %v", err)
+		}
+
+		var envelope logEnvelope
+		if err := json.Unmarshal(got.logs.Bytes(), &envelope); err != nil {
+			t.Fatalf("formatNotification() logs are not json: %v", err)
+		}
+		want := logEnvelope{Namespace: "default", Pod: "format", Container: "app", Reason: "Error", Caption: "container: app", Logs: "second\n"}
+		if envelope != want {
+			t.Errorf("envelope = %+v, want %+v", envelope, want)
+		}
+		if got.extension != "json" {
+			t.Errorf("extension = %q, want json", got.extension)
+		}
+	})
+}
+
+func TestMultiNotifierFormatsForEveryNotifier(t *testing.T) {
+	raw := &recordingNotifier{}
+	text := &formatNotifier{format: logFormatText}
+
+	err := multiNotifier{raw, text}.SendLogs(context.Background(), &notification{
+		pod:     newTestPod("default", "multi-format"),
+		caption: "caption",
+		logs:    bytes.NewBufferString("logs\n"),
+	})
+	if err != nil {
+		t.Fatalf("SendLogs() error = %v", err)
+	}
+
+	if len(raw.logs) != 1 || raw.logs[0] != "logs\n" {
+		t.Errorf("raw notifier logs = %q, want logs as is", raw.logs)
+	}
+	if len(text.logs) != 1 || text.logs[0] != "caption\n\nlogs\n" {
+		t.Errorf("text notifier logs = %q, want caption and logs", text.logs)
+	}
+}
+
+func TestMultiNotifierRetriesOnlyFailed(t *testing.T) {
+	ok := &recordingNotifier{}
+	failing := &recordingNotifier{err: errors.New("unavailable")}
+	m := multiNotifier{ok, failing}
+
+	pod := newTestPod("default", "partial", terminatedStatus("app", "Error", 1, time.Minute))
+	send := func() error {
+		return m.SendLogs(context.Background(), &notification{
+			pod:           pod,
+			containerName: "app",
+			logs:          bytes.NewBufferString("logs\n"),
+		})
+	}
+
+	if err := send(); err == nil {
+		t.Fatal("SendLogs() error = nil, want error of failed notifier")
+	}
+
+	failing.err = nil
+	if err := send(); err != nil {
+		t.Fatalf("SendLogs() retry error = %v", err)
+	}
+
+	if len(ok.logs) != 1 {
+		t.Errorf("delivered notifier got %d logs, want 1", len(ok.logs))
+	}
+	if len(failing.logs) != 1 {
+		t.Errorf("failed notifier got %d logs, want 1", len(failing.logs))
+	}
+
+	if err := send(); err != nil {
+		t.Fatalf("SendLogs() error = %v", err)
+	}
+	if len(ok.logs) != 2 || len(failing.logs) != 2 {
+		t.Errorf("notifiers got %d and %d logs after full delivery, want 2 and 2", len(ok.logs), len(failing.logs))
+	}
+}
+
+func TestMultiNotifierSendsEveryPodCrash(t *testing.T) {
+	ok := &recordingNotifier{}
+	failing := &recordingNotifier{err: errors.New("unavailable")}
+	m := multiNotifier{ok, failing}
+
+	pod := newTestPod("default", "partial-pod", terminatedStatus("app", "Error", 1, time.Minute))
+	send := func(pod *v1.Pod) error {
+		// logs of whole pod with --group-by-pod have no container name
+		return m.SendLogs(context.Background(), &notification{
+			pod:  pod,
+			name: notificationName(pod, ""),
+			logs: bytes.NewBufferString("logs\n"),
+		})
+	}
+
+	if err := send(pod); err == nil {
+		t.Fatal("SendLogs() error = nil, want error of failed notifier")
+	}
+
+	// the same pod crashed again before retry of first crash
+	crashed := pod.DeepCopy()
+	crashed.Status.ContainerStatuses = []v1.ContainerStatus{terminatedStatus("app", "Error", 1, time.Second)}
+	crashed.Status.ContainerStatuses[0].RestartCount = 1
+
+	failing.err = nil
+	if err := send(crashed); err != nil {
+		t.Fatalf("SendLogs() error = %v", err)
+	}
+
+	if len(ok.logs) != 2 {
+		t.Errorf("delivered notifier got %d logs, want 2 for two crashes", len(ok.logs))
+	}
+	if len(failing.logs) != 1 {
+		t.Errorf("failed notifier got %d logs, want 1", len(failing.logs))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	notifyOnTerminated = "terminated"
+	notifyOnRestarted  = "restarted"
+	notifyOnBoth       = "both"
+)
+
+func validateNotifyOn(mode string) error {
+	switch mode {
+	case notifyOnTerminated, notifyOnRestarted, notifyOnBoth:
+		return nil
+	}
+
+	return fmt.Errorf("[validateNotifyOn] unknown --notify-on mode %q", mode)
+}
+
+// effectivePod returns pod which container statuses are terminated
+// according to --notify-on. Last termination of restarted container is
+// set as its current terminated state, equal states mark status as
+// restarted, see isRestartedStatus.
+func effectivePod(pod *v1.Pod) *v1.Pod {
+	if notifyOn == notifyOnTerminated {
+		return pod
+	}
+
+	pod = pod.DeepCopy()
+	for i := range pod.Status.ContainerStatuses {
+		status := &pod.Status.ContainerStatuses[i]
+
+		if notifyOn == notifyOnBoth && status.State.Terminated != nil {
+			continue
+		}
+
+		status.State.Terminated = status.LastTerminationState.Terminated
+	}
+
+	return pod
+}
+
+// isRestartedStatus reports whether terminated state of container status
+// is its last termination set by effectivePod, logs of such termination
+// are previous container logs.
+// States are compared by value, so status stays restarted in pod copies.
+func isRestartedStatus(containerStatus v1.ContainerStatus) bool {
+	current := containerStatus.State.Terminated
+	last := containerStatus.LastTerminationState.Terminated
+	if current == nil || last == nil {
+		return false
+	}
+
+	return current.ContainerID == last.ContainerID && current.FinishedAt.Equal(&last.FinishedAt)
+}
+
+// withLastTermination returns copy of pod which container last termination
+// is set as its current terminated state, so container is treated as
+// restarted and its previous logs are sent.
+func withLastTermination(pod *v1.Pod, containerName string) *v1.Pod {
+	pod = pod.DeepCopy()
+	if status := findContainerStatus(pod, containerName); status != nil {
+		status.State.Terminated = status.LastTerminationState.Terminated
+	}
+
+	return pod
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsRestartedStatus(t *testing.T) {
+	last := &v1.ContainerStateTerminated{
+		ContainerID: "containerd://old",
+		FinishedAt:  metav1.NewTime(time.Now().Add(-time.Minute)),
+	}
+	current := &v1.ContainerStateTerminated{
+		ContainerID: "containerd://new",
+		FinishedAt:  metav1.NewTime(time.Now()),
+	}
+
+	tests := []struct {
+		name   string
+		status v1.ContainerStatus
+		want   bool
+	}{
+		{
+			name: "not terminated",
+			status: v1.ContainerStatus{
+				LastTerminationState: v1.ContainerState{Terminated: last},
+			},
+			want: false,
+		},
+		{
+			name: "terminated without restart",
+			status: v1.ContainerStatus{
+				State: v1.ContainerState{Terminated: current},
+			},
+			want: false,
+		},
+		{
+			name: "terminated after restart",
+			status: v1.ContainerStatus{
+				State:                v1.ContainerState{Terminated: current},
+				LastTerminationState: v1.ContainerState{Terminated: last},
+			},
+			want: false,
+		},
+		{
+			name: "last termination set as current",
+			status: v1.ContainerStatus{
+				State:                v1.ContainerState{Terminated: last},
+				LastTerminationState: v1.ContainerState{Terminated: last},
+			},
+			want: true,
+		},
+		{
+			name: "last termination copy set as current",
+			status: v1.ContainerStatus{
+				State:                v1.ContainerState{Terminated: last.DeepCopy()},
+				LastTerminationState: v1.ContainerState{Terminated: last},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRestartedStatus(tt.status); got != tt.want {
+				t.Errorf("isRestartedStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePodDeepCopyIsRestarted(t *testing.T) {
+	saved := notifyOn
+	defer func() { notifyOn = saved }()
+	notifyOn = notifyOnRestarted
+
+	pod := newTestPod("default", "restarted", runningStatus("app"))
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &v1.ContainerStateTerminated{
+		ContainerID: "containerd://old",
+		FinishedAt:  metav1.NewTime(time.Now()),
+	}
+
+	copied := effectivePod(pod).DeepCopy()
+	if !isRestartedStatus(copied.Status.ContainerStatuses[0]) {
+		t.Error("isRestartedStatus() = false for copy of effective pod, want true")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// watchedNamespaces returns namespaces selected by --namespace-selector or
+// --namespace.
+func watchedNamespaces(ctx context.Context) ([]string, error) {
+	if len(namespaceSelector) == 0 {
+		return []string{namespace}, nil
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: namespaceSelector})
+	if err != nil {
+		return nil, fmt.Errorf("[watchedNamespaces] failed list namespaces: %s", err)
+	}
+
+	names := make([]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.GetName())
+	}
+
+	return names, nil
+}
+
+// runOnce processes all pods of watched namespaces once without informers.
+func runOnce(ctx context.Context) error {
+	namespaces, err := watchedNamespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("[runOnce] %s", err)
+	}
+
+	for _, ns := range namespaces {
+		pods, err := clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{FieldSelector: podFieldSelector()})
+		if err != nil {
+			return fmt.Errorf("[runOnce] failed list pods in namespace %s: %s", ns, err)
+		}
+
+		for i := range pods.Items {
+			processPod(ctx, &pods.Items[i])
+		}
+	}
+
+	flushState()
+
+	return nil
+}
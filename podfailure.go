@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+var (
+	failedPodsMu sync.Mutex
+	// failedPods holds uid of failed pods already notified by pod key
+	failedPods = map[string]types.UID{}
+)
+
+// describePod returns short human readable description of pod status.
+func describePod(pod *v1.Pod) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "pod: %s/%s\n", pod.GetNamespace(), pod.GetName())
+	fmt.Fprintf(&b, "phase: %s\n", pod.Status.Phase)
+	if len(pod.Status.Reason) > 0 {
+		fmt.Fprintf(&b, "reason: %s\n", pod.Status.Reason)
+	}
+	if len(pod.Status.Message) > 0 {
+		fmt.Fprintf(&b, "message: %s\n", pod.Status.Message)
+	}
+	if len(pod.Spec.NodeName) > 0 {
+		fmt.Fprintf(&b, "node: %s\n", pod.Spec.NodeName)
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		state := containerStatus.State
+		switch {
+		case state.Terminated != nil:
+			fmt.Fprintf(&b, "container %s: terminated, reason: %s, exit code: %d\n",
+				containerStatus.Name, state.Terminated.Reason, state.Terminated.ExitCode)
+		case state.Waiting != nil:
+			fmt.Fprintf(&b, "container %s: waiting, reason: %s\n", containerStatus.Name, state.Waiting.Reason)
+		case state.Running != nil:
+			fmt.Fprintf(&b, "container %s: running\n", containerStatus.Name)
+		}
+	}
+
+	return b.String()
+}
+
+// podFailedAt returns time of pod failure, it is the latest container
+// termination or transition of Ready condition for pods failed without
+// terminated containers, e.g. evicted.
+func podFailedAt(pod *v1.Pod) time.Time {
+	var failedAt time.Time
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if terminated := containerStatus.State.Terminated; terminated != nil && terminated.FinishedAt.After(failedAt) {
+			failedAt = terminated.FinishedAt.Time
+		}
+	}
+
+	if failedAt.IsZero() {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodReady {
+				failedAt = condition.LastTransitionTime.Time
+			}
+		}
+	}
+
+	return failedAt
+}
+
+// isFailureRecent reports whether failure of named object happened within
+// --delay, so pods and jobs failed long ago are not notified again after
+// restart.
+func isFailureRecent(name string, failedAt time.Time) bool {
+	if failedAt.IsZero() {
+		klog.V(3).Infof("Failure of %s is skipped, failure time is unknown", name)
+		return false
+	}
+
+	age := time.Since(failedAt)
+	if ignoreOlderThan > 0 && age >= ignoreOlderThan {
+		klog.V(4).Infof("Failure of %s is skipped, failed %s ago, older than %s", name, age, ignoreOlderThan)
+		return false
+	}
+
+	if age >= time.Duration(delay)*time.Second {
+		klog.V(4).Infof("Failure of %s is skipped, failed %s ago, out of delay %ds", name, age, delay)
+		return false
+	}
+
+	return true
+}
+
+// processPodFailure sends pod description once for every failed pod, pod
+// is marked as notified only after successful send.
+func processPodFailure(ctx context.Context, pod *v1.Pod) error {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	failedPodsMu.Lock()
+	notified := failedPods[key] == pod.GetUID()
+	failedPodsMu.Unlock()
+
+	if notified || !isFailureRecent("pod "+key, podFailedAt(pod)) {
+		return nil
+	}
+
+	klog.Infof("Send failure of pod: %s, reason: %s", pod.GetName(), pod.Status.Reason)
+
+	err := sendMessage(ctx, pod, describePod(pod))
+	if err != nil {
+		recordSendError(pod, err)
+		return fmt.Errorf("[processPodFailure] failed send pod description: %s", err)
+	}
+
+	failedPodsMu.Lock()
+	failedPods[key] = pod.GetUID()
+	failedPodsMu.Unlock()
+
+	return nil
+}
+
+// forgetPodFailure removes deleted pod from notified failed pods.
+func forgetPodFailure(key string) {
+	failedPodsMu.Lock()
+	delete(failedPods, key)
+	failedPodsMu.Unlock()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func failedTestPod(name string, ago time.Duration) *v1.Pod {
+	pod := newTestPod("default", name, terminatedStatus("app", "Error", 1, ago))
+	pod.Status.Phase = v1.PodFailed
+	return pod
+}
+
+func TestProcessPodFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want int
+	}{
+		{
+			name: "failed within delay",
+			pod:  failedTestPod("failed-recently", time.Second),
+			want: 1,
+		},
+		{
+			name: "failed out of delay",
+			pod:  failedTestPod("failed-long-ago", time.Hour),
+		},
+		{
+			name: "unknown failure time",
+			pod: func() *v1.Pod {
+				pod := newTestPod("default", "failed-unknown")
+				pod.Status.Phase = v1.PodFailed
+				return pod
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, restore := setupTest(t, tt.pod)
+			defer restore()
+
+			for i := 0; i < 2; i++ {
+				if err := processPodFailure(context.Background(), tt.pod); err != nil {
+					t.Fatalf("processPodFailure() error = %v", err)
+				}
+			}
+
+			if len(recorder.messages) != tt.want {
+				t.Errorf("sent messages = %d, want %d", len(recorder.messages), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPodFailureRetriesFailedSend(t *testing.T) {
+	pod := failedTestPod("failed-send-retry", time.Second)
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	recorder.err = errors.New("unavailable")
+	if err := processPodFailure(context.Background(), pod); err == nil {
+		t.Fatal("processPodFailure() error = nil, want send error")
+	}
+
+	recorder.err = nil
+	if err := processPodFailure(context.Background(), pod); err != nil {
+		t.Fatalf("processPodFailure() error = %v on retry", err)
+	}
+
+	if len(recorder.messages) != 1 {
+		t.Errorf("sent messages = %d, want 1", len(recorder.messages))
+	}
+}
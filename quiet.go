@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	quietHoursBuffer = "buffer"
+	quietHoursDrop   = "drop"
+
+	// maxQuietBuffered limits logs buffered during quiet hours, oldest logs
+	// are dropped
+	maxQuietBuffered = 1000
+)
+
+// quietHours is daily window in location, window may pass midnight.
+type quietHours struct {
+	// start and end are minutes since midnight
+	start, end int
+	loc        *time.Location
+}
+
+var (
+	quiet *quietHours
+
+	quietMu sync.Mutex
+	// quietBuffered holds logs sent during quiet hours in buffer mode
+	quietBuffered []*notification
+)
+
+// parseClock parses time of day in format HH:MM to minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseQuietHours parses window in format HH:MM-HH:MM in timezone.
+func parseQuietHours(value string, timezone string, mode string) (*quietHours, error) {
+	switch mode {
+	case quietHoursBuffer, quietHoursDrop:
+	default:
+		return nil, fmt.Errorf("[parseQuietHours] unknown quiet hours mode %q", mode)
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("[parseQuietHours] invalid quiet hours %q, expected format: HH:MM-HH:MM", value)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("[parseQuietHours] invalid quiet hours start %q: %s", parts[0], err)
+	}
+
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("[parseQuietHours] invalid quiet hours end %q: %s", parts[1], err)
+	}
+
+	if start == end {
+		return nil, fmt.Errorf("[parseQuietHours] quiet hours %q are empty", value)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("[parseQuietHours] failed load timezone %q: %s", timezone, err)
+	}
+
+	return &quietHours{start: start, end: end, loc: loc}, nil
+}
+
+// active reports whether t is within quiet hours.
+func (q *quietHours) active(t time.Time) bool {
+	t = t.In(q.loc)
+	minute := t.Hour()*60 + t.Minute()
+
+	if q.start < q.end {
+		return minute >= q.start && minute < q.end
+	}
+
+	return minute >= q.start || minute < q.end
+}
+
+// holdQuiet buffers or drops logs during quiet hours according to
+// --quiet-hours-mode, it returns false if logs may be sent now.
+func holdQuiet(n *notification) bool {
+	if quiet == nil || !quiet.active(time.Now()) {
+		return false
+	}
+
+	if quietHoursMode == quietHoursDrop {
+		klog.V(2).Infof("Drop logs %s, quiet hours", n.name)
+		recordQuietDropped()
+		return true
+	}
+
+	buffered := *n
+	buffered.logs = bytes.NewBuffer(n.logs.Bytes())
+
+	quietMu.Lock()
+	quietBuffered = append(quietBuffered, &buffered)
+	if len(quietBuffered) > maxQuietBuffered {
+		quietBuffered = quietBuffered[1:]
+		recordQuietDropped()
+	}
+	quietMu.Unlock()
+
+	klog.V(2).Infof("Buffer logs %s until quiet hours end", n.name)
+
+	return true
+}
+
+// flushQuiet sends logs buffered during quiet hours once they end.
+func flushQuiet(ctx context.Context) {
+	if quiet.active(time.Now()) {
+		return
+	}
+
+	quietMu.Lock()
+	buffered := quietBuffered
+	quietBuffered = nil
+	quietMu.Unlock()
+
+	if len(buffered) > 0 {
+		klog.Infof("Quiet hours ended, send %d buffered logs", len(buffered))
+	}
+
+	for _, n := range buffered {
+		err := deliverNotification(ctx, n)
+		if err != nil {
+			klog.Errorf("[flushQuiet] failed send buffered logs: %s", err)
+			recordSendError(n.pod, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// requiredAccess is permission required by enabled features.
+type requiredAccess struct {
+	group       string
+	resource    string
+	subresource string
+	verb        string
+	namespace   string
+}
+
+func (a requiredAccess) String() string {
+	resource := a.resource
+	if len(a.subresource) > 0 {
+		resource = fmt.Sprintf("%s/%s", resource, a.subresource)
+	}
+	if len(a.group) > 0 {
+		resource = fmt.Sprintf("%s.%s", resource, a.group)
+	}
+
+	scope := "all namespaces"
+	if len(a.namespace) > 0 {
+		scope = fmt.Sprintf("namespace %s", a.namespace)
+	}
+
+	return fmt.Sprintf("%s %s in %s", a.verb, resource, scope)
+}
+
+// accessesOf returns permissions of verbs on resource.
+func accessesOf(group string, resource string, namespace string, verbs ...string) []requiredAccess {
+	accesses := make([]requiredAccess, 0, len(verbs))
+	for _, verb := range verbs {
+		accesses = append(accesses, requiredAccess{group: group, resource: resource, verb: verb, namespace: namespace})
+	}
+
+	return accesses
+}
+
+// requiredAccesses returns permissions required by enabled features.
+// Namespaces selected by labels aren't known before start, so resources
+// watched in them are required in all namespaces.
+func requiredAccesses() []requiredAccess {
+	watchedNamespace := namespace
+	if len(namespaceSelector) > 0 {
+		watchedNamespace = metav1.NamespaceAll
+	}
+
+	accesses := accessesOf("", "pods", watchedNamespace, "get", "list", "watch")
+	accesses = append(accesses, requiredAccess{resource: "pods", subresource: "log", verb: "get", namespace: watchedNamespace})
+
+	if len(namespaceSelector) > 0 {
+		accesses = append(accesses, accessesOf("", "namespaces", metav1.NamespaceAll, "list", "watch")...)
+	}
+
+	if len(nodeName) > 0 {
+		accesses = append(accesses, requiredAccess{resource: "nodes", verb: "get"})
+	}
+
+	if len(routeConfigMap) > 0 {
+		cmNamespace, _, err := cache.SplitMetaNamespaceKey(routeConfigMap)
+		if err == nil {
+			if len(cmNamespace) == 0 {
+				cmNamespace = namespace
+			}
+			accesses = append(accesses, accessesOf("", "configmaps", cmNamespace, "list", "watch")...)
+		}
+	}
+
+	if watchJobs {
+		accesses = append(accesses, accessesOf("batch", "jobs", watchedNamespace, "list", "watch")...)
+	}
+
+	if watchTargets {
+		accesses = append(accesses, accessesOf(logForwardTargetResource.Group, logForwardTargetResource.Resource, watchedNamespace, "list", "watch")...)
+	}
+
+	if includeEvents || attachPodManifest {
+		accesses = append(accesses, requiredAccess{resource: "events", verb: "list", namespace: watchedNamespace})
+	}
+
+	if enableLeaderElection {
+		accesses = append(accesses, accessesOf("coordination.k8s.io", "leases", leaderElectionNamespace, "get", "create", "update")...)
+	}
+
+	return accesses
+}
+
+// checkAccess asks api server whether controller has every required
+// permission, missing permissions are returned as single error.
+func checkAccess(ctx context.Context, accesses []requiredAccess) error {
+	var missing []string
+
+	for _, a := range accesses {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   a.namespace,
+					Verb:        a.verb,
+					Group:       a.group,
+					Resource:    a.resource,
+					Subresource: a.subresource,
+				},
+			},
+		}
+
+		result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("[checkAccess] failed create self subject access review: %s", err)
+		}
+
+		if !result.Status.Allowed {
+			missing = append(missing, a.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("[checkAccess] RBAC permissions are missing, grant them to service account or use --skip-rbac-check: %s", strings.Join(missing, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRequiredAccesses(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func()
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "pods in namespace",
+			want: []string{
+				"watch pods in namespace default",
+				"get pods/log in namespace default",
+			},
+			notWant: []string{
+				"list namespaces in all namespaces",
+				"list events in namespace default",
+				"create leases.coordination.k8s.io in namespace kube-system",
+			},
+		},
+		{
+			name:  "namespace selector",
+			setup: func() { namespaceSelector = "team=a" },
+			want: []string{
+				"list namespaces in all namespaces",
+				"watch namespaces in all namespaces",
+				"watch pods in all namespaces",
+				"get pods/log in all namespaces",
+			},
+			notWant: []string{"watch pods in namespace default"},
+		},
+		{
+			name: "enabled features",
+			setup: func() {
+				enableLeaderElection = true
+				leaderElectionNamespace = "kube-system"
+				routeConfigMap = "ops/routes"
+				watchJobs = true
+				nodeName = "node-1"
+				watchTargets = true
+				attachPodManifest = true
+			},
+			want: []string{
+				"create leases.coordination.k8s.io in namespace kube-system",
+				"update leases.coordination.k8s.io in namespace kube-system",
+				"watch configmaps in namespace ops",
+				"watch jobs.batch in namespace default",
+				"get nodes in all namespaces",
+				"watch logforwardtargets.logs-sender.io in namespace default",
+				"list events in namespace default",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := []interface{}{namespace, namespaceSelector, enableLeaderElection, leaderElectionNamespace, routeConfigMap, watchJobs, nodeName, watchTargets, includeEvents, attachPodManifest}
+			defer func() {
+				namespace, namespaceSelector = saved[0].(string), saved[1].(string)
+				enableLeaderElection, leaderElectionNamespace = saved[2].(bool), saved[3].(string)
+				routeConfigMap, watchJobs, nodeName = saved[4].(string), saved[5].(bool), saved[6].(string)
+				watchTargets, includeEvents, attachPodManifest = saved[7].(bool), saved[8].(bool), saved[9].(bool)
+			}()
+
+			namespace, namespaceSelector = "default", ""
+			enableLeaderElection, leaderElectionNamespace = false, "default"
+			routeConfigMap, watchJobs, nodeName = "", false, ""
+			watchTargets, includeEvents, attachPodManifest = false, false, false
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			got := map[string]bool{}
+			for _, a := range requiredAccesses() {
+				got[a.String()] = true
+			}
+
+			for _, access := range tt.want {
+				if !got[access] {
+					t.Errorf("requiredAccesses() doesn't contain %q", access)
+				}
+			}
+			for _, access := range tt.notWant {
+				if got[access] {
+					t.Errorf("requiredAccesses() contains %q", access)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// resendLogs sends current and previous logs of all pod containers or of
+// single container if name is not empty. Pod is set as namespace/name.
+func resendLogs(ctx context.Context, key string, containerName string) error {
+	podNamespace, podName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("[resendLogs] invalid pod %s, expected format: namespace/pod: %s", key, err)
+	}
+	if len(podNamespace) == 0 {
+		podNamespace = namespace
+	}
+
+	pod, err := clientset.CoreV1().Pods(podNamespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("[resendLogs] failed get pod %s: %s", key, err)
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if len(containerName) > 0 && containerStatus.Name != containerName {
+			continue
+		}
+
+		klog.Infof("Resend logs from pod: %s, container: %s", pod.GetName(), containerStatus.Name)
+
+		// previous logs are added regardless of --short-log-lines
+		err = sendContainerLogs(ctx, pod, containerStatus.Name, true)
+		if err != nil {
+			return fmt.Errorf("[resendLogs] failed send container %s logs: %s", containerStatus.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestResendLogsAddsPreviousLogs(t *testing.T) {
+	status := runningStatus("app")
+	status.RestartCount = 1
+	pod := newTestPod("default", "resend", status)
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	openPodLogs = func(ctx context.Context, pod *v1.Pod, opts *v1.PodLogOptions) (io.ReadCloser, error) {
+		if opts.Previous {
+			return ioutil.NopCloser(strings.NewReader("previous\n")), nil
+		}
+		return ioutil.NopCloser(strings.NewReader("current\n")), nil
+	}
+
+	if err := resendLogs(context.Background(), "default/resend", ""); err != nil {
+		t.Fatalf("resendLogs() error = %v", err)
+	}
+
+	if len(recorder.logs) != 1 || !strings.Contains(recorder.logs[0], "previous\n") {
+		t.Fatalf("sent logs = %q, want previous logs", recorder.logs)
+	}
+
+	// resend does not change logs sent by controller
+	if err := sendContainerLogs(context.Background(), pod, "app", false); err != nil {
+		t.Fatalf("sendContainerLogs() error = %v", err)
+	}
+	if got := recorder.logs[1]; got != "current\n" {
+		t.Errorf("sent logs after resend = %q, want only current logs", got)
+	}
+}
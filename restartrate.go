@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// restartEvent is increase of container restart count seen at time.
+type restartEvent struct {
+	at    time.Time
+	delta int32
+}
+
+// containerRestartRate holds recent restarts of container.
+type containerRestartRate struct {
+	count    int32
+	events   []restartEvent
+	notified bool
+}
+
+// podRestartRates holds restart rates of every container of pod.
+type podRestartRates struct {
+	uid        types.UID
+	containers map[string]*containerRestartRate
+}
+
+var (
+	restartRatesMu sync.Mutex
+	// restartRates holds container restart rates by pod key
+	restartRates = map[string]*podRestartRates{}
+)
+
+// observeRestartRate records restart count of container and reports
+// whether its restarts per minute over --restart-rate-window exceeded
+// --restart-rate-threshold, it is reported once until rate goes down.
+func observeRestartRate(pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+	now := time.Now()
+
+	restartRatesMu.Lock()
+	defer restartRatesMu.Unlock()
+
+	p, ok := restartRates[key]
+	if !ok || p.uid != pod.GetUID() {
+		p = &podRestartRates{uid: pod.GetUID(), containers: map[string]*containerRestartRate{}}
+		restartRates[key] = p
+	}
+
+	c, ok := p.containers[containerStatus.Name]
+	if !ok {
+		// restarts before container was first seen are not timed
+		p.containers[containerStatus.Name] = &containerRestartRate{count: containerStatus.RestartCount}
+		return false
+	}
+
+	if containerStatus.RestartCount > c.count {
+		c.events = append(c.events, restartEvent{at: now, delta: containerStatus.RestartCount - c.count})
+	}
+	c.count = containerStatus.RestartCount
+
+	var restarted int32
+	events := c.events[:0]
+	for _, e := range c.events {
+		if now.Sub(e.at) <= restartRateWindow {
+			events = append(events, e)
+			restarted += e.delta
+		}
+	}
+	c.events = events
+
+	rate := float64(restarted) / restartRateWindow.Minutes()
+	if rate < restartRateThreshold {
+		c.notified = false
+		return false
+	}
+
+	if c.notified {
+		return false
+	}
+
+	klog.V(4).Infof("Container %s restart rate %.2f/min exceeded %.2f/min", containerStatus.Name, rate, restartRateThreshold)
+	c.notified = true
+
+	return true
+}
+
+// releaseRestartRate allows high restart rate of container to be reported
+// again, it is called when send failed.
+func releaseRestartRate(pod *v1.Pod, containerName string) {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	restartRatesMu.Lock()
+	defer restartRatesMu.Unlock()
+
+	if p, ok := restartRates[key]; ok && p.uid == pod.GetUID() {
+		if c, ok := p.containers[containerName]; ok {
+			c.notified = false
+		}
+	}
+}
+
+// processRestartRates sends last crash logs of matched containers which
+// restart faster than --restart-rate-threshold, container may be running
+// at the moment, so its last termination is reported.
+func processRestartRates(ctx context.Context, pod *v1.Pod) {
+	if restartRateThreshold <= 0 {
+		return
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if !isContainerMatched(pod, containerStatus) || containerStatus.LastTerminationState.Terminated == nil {
+			continue
+		}
+
+		if !observeRestartRate(pod, containerStatus) {
+			continue
+		}
+
+		klog.Infof("Send logs from pod: %s, container: %s, high restart rate, restarts: %d", pod.GetName(), containerStatus.Name, containerStatus.RestartCount)
+
+		err := sendContainerLogs(ctx, withLastTermination(pod, containerStatus.Name), containerStatus.Name, false)
+		if err != nil {
+			klog.Errorf("[processRestartRates] failed send container logs: %s", err)
+			recordSendError(pod, err)
+			releaseRestartRate(pod, containerStatus.Name)
+		}
+	}
+}
+
+// forgetRestartRates removes deleted pod from restart rates.
+func forgetRestartRates(key string) {
+	restartRatesMu.Lock()
+	delete(restartRates, key)
+	restartRatesMu.Unlock()
+}
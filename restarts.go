@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// podRestarts holds restart count of every container of pod at the moment
+// it was last seen stable.
+type podRestarts struct {
+	uid       types.UID
+	baselines map[string]int32
+}
+
+var (
+	restartsMu sync.Mutex
+	// restarts holds container restart baselines by pod key
+	restarts = map[string]*podRestarts{}
+)
+
+// restartsFor returns restart baselines of pod, baselines of recreated pod
+// with the same name are dropped. It must be called with restartsMu held.
+func restartsFor(pod *v1.Pod) *podRestarts {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	r, ok := restarts[key]
+	if !ok || r.uid != pod.GetUID() {
+		r = &podRestarts{uid: pod.GetUID(), baselines: map[string]int32{}}
+		restarts[key] = r
+	}
+
+	return r
+}
+
+// observeRestarts resets restart counter of container which is running
+// longer than --min-restarts-reset.
+func observeRestarts(pod *v1.Pod, containerStatus v1.ContainerStatus) {
+	if minRestarts <= 0 {
+		return
+	}
+
+	running := containerStatus.State.Running
+	if running == nil || time.Since(running.StartedAt.Time) < minRestartsReset {
+		return
+	}
+
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	r := restartsFor(pod)
+	if r.baselines[containerStatus.Name] != containerStatus.RestartCount {
+		klog.V(4).Infof("Container %s is stable, reset restarts counter at %d", containerStatus.Name, containerStatus.RestartCount)
+		r.baselines[containerStatus.Name] = containerStatus.RestartCount
+	}
+}
+
+// isRestartsReached reports whether container restarted at least
+// --min-restarts times since it was last seen stable.
+func isRestartsReached(pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	if minRestarts <= 0 {
+		return true
+	}
+
+	restartsMu.Lock()
+	count := containerStatus.RestartCount - restartsFor(pod).baselines[containerStatus.Name]
+	restartsMu.Unlock()
+
+	if count < int32(minRestarts) {
+		klog.V(4).Infof("Container %s is skipped, restarted %d times, less than %d", containerStatus.Name, count, minRestarts)
+		return false
+	}
+
+	return true
+}
+
+// forgetRestarts removes deleted pod from restart counters.
+func forgetRestarts(key string) {
+	restartsMu.Lock()
+	delete(restarts, key)
+	restartsMu.Unlock()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// destination is a telegram chat and optional forum topic in it.
+type destination struct {
+	chatID  int64
+	topicID int64
+}
+
+// podRoute routes pods with names matched by pattern to destination
+// expanded from template, template may refer pattern capture groups.
+type podRoute struct {
+	pattern  *regexp.Regexp
+	template string
+}
+
+// podRoutePrefix marks route by pod name pattern
+const podRoutePrefix = "pod:"
+
+// parseDestination parses destination in form chatID[:topicID] or chat
+// alias name.
+func parseDestination(value string) (destination, error) {
+	var dest destination
+	var err error
+
+	if dest, ok := chatAliases[value]; ok {
+		return dest, nil
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+
+	dest.chatID, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return dest, fmt.Errorf("[parseDestination] invalid chat id %q: %s", parts[0], err)
+	}
+
+	if len(parts) == 2 {
+		dest.topicID, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return dest, fmt.Errorf("[parseDestination] invalid topic id %q: %s", parts[1], err)
+		}
+	}
+
+	return dest, nil
+}
+
+// parseChatAliases parses chat aliases in form name=chatID[:topicID].
+func parseChatAliases(rules []string) (map[string]destination, error) {
+	aliases := make(map[string]destination, len(rules))
+
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("[parseChatAliases] invalid chat alias %q, expected name=chatID[:topicID]", rule)
+		}
+
+		dest, err := parseDestination(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("[parseChatAliases] invalid chat alias %q: %s", rule, err)
+		}
+
+		aliases[parts[0]] = dest
+	}
+
+	return aliases, nil
+}
+
+// parseRoutes parses routing rules in form namespace=destination or
+// pod:regexp=template, template is expanded with regexp capture groups,
+// e.g. pod:^team-(\w+)-.*=chat-for-$1.
+func parseRoutes(rules []string) (map[string]destination, []podRoute, error) {
+	routes := make(map[string]destination, len(rules))
+	var byPod []podRoute
+
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, podRoutePrefix) {
+			// pattern may contain "=", so template is after the last one
+			i := strings.LastIndex(rule, "=")
+			if i <= len(podRoutePrefix) {
+				return nil, nil, fmt.Errorf("[parseRoutes] invalid route %q, expected pod:regexp=template", rule)
+			}
+
+			pattern, err := regexp.Compile(rule[len(podRoutePrefix):i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("[parseRoutes] invalid pattern in route %q: %s", rule, err)
+			}
+
+			route := podRoute{pattern: pattern, template: rule[i+1:]}
+			if !strings.Contains(route.template, "$") {
+				_, err = parseDestination(route.template)
+				if err != nil {
+					return nil, nil, fmt.Errorf("[parseRoutes] invalid route %q: %s", rule, err)
+				}
+			}
+
+			byPod = append(byPod, route)
+			continue
+		}
+
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, nil, fmt.Errorf("[parseRoutes] invalid route %q, expected namespace=chatID[:topicID]", rule)
+		}
+
+		dest, err := parseDestination(parts[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("[parseRoutes] invalid route %q: %s", rule, err)
+		}
+
+		routes[parts[0]] = dest
+	}
+
+	return routes, byPod, nil
+}
+
+// resolvePodRoute returns destination of first pod route matched by pod name.
+func resolvePodRoute(pod *v1.Pod) (destination, bool) {
+	name := pod.GetName()
+
+	for _, route := range podRoutes {
+		match := route.pattern.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+
+		value := string(route.pattern.ExpandString(nil, route.template, name, match))
+		dest, err := parseDestination(value)
+		if err != nil {
+			klog.Errorf("[resolvePodRoute] invalid destination %q for pod %s: %s", value, name, err)
+			continue
+		}
+
+		return dest, true
+	}
+
+	return destination{}, false
+}
+
+// routeDestination returns destination from target matched by pod
+// container, route by pod name, route configmap or route for pod
+// namespace, global chat and topic used if there is neither of them or
+// pod is nil.
+func routeDestination(pod *v1.Pod, containerName string) destination {
+	if pod == nil {
+		return destination{chatID: chatID, topicID: topicID}
+	}
+
+	if dest, ok := targetRoute(pod, containerName); ok {
+		return dest
+	}
+
+	if dest, ok := resolvePodRoute(pod); ok {
+		return dest
+	}
+
+	if dest, ok := configMapRoute(pod.GetNamespace()); ok {
+		return dest
+	}
+
+	if dest, ok := namespaceRoutes[pod.GetNamespace()]; ok {
+		return dest
+	}
+
+	return destination{chatID: chatID, topicID: topicID}
+}
+
+// resolveDestination returns destination of pod container logs with
+// respect to pod annotations.
+func resolveDestination(pod *v1.Pod, containerName string) destination {
+	return resolveSendConfig(pod, containerName).dest
+}
+
+// configuredChatIDs returns unique chat ids from --chat-id, aliases and
+// namespace routes.
+func configuredChatIDs() []int64 {
+	var ids []int64
+
+	seen := map[int64]bool{0: true}
+	if !seen[chatID] {
+		seen[chatID] = true
+		ids = append(ids, chatID)
+	}
+
+	for _, dest := range chatAliases {
+		if !seen[dest.chatID] {
+			seen[dest.chatID] = true
+			ids = append(ids, dest.chatID)
+		}
+	}
+
+	for _, dest := range namespaceRoutes {
+		if !seen[dest.chatID] {
+			seen[dest.chatID] = true
+			ids = append(ids, dest.chatID)
+		}
+	}
+
+	return ids
+}
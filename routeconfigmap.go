@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var (
+	configMapRoutesMu sync.RWMutex
+	// configMapRoutes holds namespace routes from --route-configmap, they
+	// override namespace routes from --route
+	configMapRoutes = map[string]destination{}
+)
+
+// configMapRoute returns destination of namespace from route configmap.
+func configMapRoute(namespace string) (destination, bool) {
+	configMapRoutesMu.RLock()
+	defer configMapRoutesMu.RUnlock()
+
+	dest, ok := configMapRoutes[namespace]
+	return dest, ok
+}
+
+// parseConfigMapRoutes parses configmap data, every key is namespace and
+// value is chatID[:topicID] or chat alias.
+func parseConfigMapRoutes(data map[string]string) (map[string]destination, error) {
+	routes := map[string]destination{}
+
+	for ns, value := range data {
+		dest, err := parseDestination(value)
+		if err != nil {
+			return nil, fmt.Errorf("[parseConfigMapRoutes] invalid route of namespace %s: %s", ns, err)
+		}
+		routes[ns] = dest
+	}
+
+	return routes, nil
+}
+
+// setConfigMapRoutes replaces routes by configmap data, invalid data keeps
+// previous routes.
+func setConfigMapRoutes(cm *v1.ConfigMap) {
+	routes, err := parseConfigMapRoutes(cm.Data)
+	if err != nil {
+		klog.Errorf("[setConfigMapRoutes] failed update routes from configmap %s/%s: %s", cm.GetNamespace(), cm.GetName(), err)
+		return
+	}
+
+	configMapRoutesMu.Lock()
+	configMapRoutes = routes
+	configMapRoutesMu.Unlock()
+
+	klog.Infof("Routes updated from configmap %s/%s, namespaces: %d", cm.GetNamespace(), cm.GetName(), len(routes))
+}
+
+// newRouteConfigMapInformer returns informer of configmap which data is
+// used as namespace routes, key is namespace/name.
+func newRouteConfigMapInformer(key string) (cache.Controller, error) {
+	cmNamespace, cmName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("[newRouteConfigMapInformer] invalid configmap %s, expected format: namespace/name: %s", key, err)
+	}
+	if len(cmNamespace) == 0 {
+		cmNamespace = namespace
+	}
+
+	configMapListWatcher := cache.NewFilteredListWatchFromClient(clientset.CoreV1().RESTClient(), "configmaps", cmNamespace, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", cmName).String()
+	})
+
+	_, informer := cache.NewInformer(configMapListWatcher, &v1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cm, ok := obj.(*v1.ConfigMap); ok {
+				setConfigMapRoutes(cm)
+			}
+		},
+		UpdateFunc: func(old interface{}, new interface{}) {
+			if cm, ok := new.(*v1.ConfigMap); ok {
+				setConfigMapRoutes(cm)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			configMapRoutesMu.Lock()
+			configMapRoutes = map[string]destination{}
+			configMapRoutesMu.Unlock()
+
+			klog.Infof("Routes configmap %s is deleted", key)
+		},
+	})
+
+	return informer, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// sentry drops events larger than 200KB
+	sentryMaxLogBytes = 100 * 1024
+	// sentry truncates message longer than 8192 characters
+	sentryMaxMessageLen = 8192
+)
+
+type sentryNotifier struct {
+	storeURL string
+	key      string
+}
+
+// newSentryNotifier parses dsn in format https://key@host/projectID.
+func newSentryNotifier(dsn string) (*sentryNotifier, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("[newSentryNotifier] failed parse sentry dsn: %s", err)
+	}
+
+	projectID := strings.Trim(u.Path, "/")
+	if u.User == nil || len(u.User.Username()) == 0 || len(projectID) == 0 {
+		return nil, fmt.Errorf("[newSentryNotifier] invalid sentry dsn, expected format: https://key@host/projectID")
+	}
+
+	return &sentryNotifier{
+		storeURL: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, projectID),
+		key:      u.User.Username(),
+	}, nil
+}
+
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+type sentryEvent struct {
+	EventID   string            `json:"event_id"`
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Logger    string            `json:"logger"`
+	Platform  string            `json:"platform"`
+	Message   sentryMessage     `json:"message"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Extra     map[string]string `json:"extra,omitempty"`
+}
+
+// sentryEventID returns random uuid without dashes.
+func sentryEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// sentryTags returns pod and container metadata as event tags.
+func sentryTags(pod *v1.Pod, containerName string) map[string]string {
+	if pod == nil {
+		return nil
+	}
+
+	tags := map[string]string{
+		"namespace": pod.GetNamespace(),
+		"pod":       pod.GetName(),
+	}
+
+	if node := pod.Spec.NodeName; len(node) > 0 {
+		tags["node"] = node
+	}
+
+	if containerStatus := findContainerStatus(pod, containerName); containerStatus != nil {
+		tags["container"] = containerStatus.Name
+		tags["image"] = containerStatus.Image
+		if terminated := containerStatus.State.Terminated; terminated != nil {
+			tags["reason"] = terminated.Reason
+			tags["exit_code"] = strconv.Itoa(int(terminated.ExitCode))
+		}
+	}
+
+	return tags
+}
+
+// LogFormat returns text format, caption is sent in logs, metadata of
+// container is sent as event tags.
+func (s *sentryNotifier) LogFormat() logFormat {
+	return logFormatText
+}
+
+func (s *sentryNotifier) MaxLogBytes() int {
+	return sentryMaxLogBytes
+}
+
+func (s *sentryNotifier) SendLogs(ctx context.Context, n *notification) error {
+	return s.post(ctx, sentryEvent{
+		EventID:   sentryEventID(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Level:     "error",
+		Logger:    "k8s-container-logs-sender",
+		Platform:  "other",
+		Message:   sentryMessage{Formatted: truncateText(n.name, sentryMaxMessageLen)},
+		Tags:      sentryTags(n.pod, n.containerName),
+		Extra:     map[string]string{"logs": n.logs.String()},
+	})
+}
+
+func (s *sentryNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	return s.post(ctx, sentryEvent{
+		EventID:   sentryEventID(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Level:     "warning",
+		Logger:    "k8s-container-logs-sender",
+		Platform:  "other",
+		Message:   sentryMessage{Formatted: truncateText(text, sentryMaxMessageLen)},
+		Tags:      sentryTags(pod, ""),
+	})
+}
+
+func (s *sentryNotifier) post(ctx context.Context, event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("[sentryNotifier.post] failed marshal event: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("[sentryNotifier.post] failed create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=k8s-container-logs-sender/%s, sentry_key=%s", version, s.key))
+
+	resp, err := (&http.Client{Transport: notifierTransport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("[sentryNotifier.post] failed send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("[sentryNotifier.post] unexpected response %s: %s", resp.Status, respBody)
+	}
+
+	return nil
+}
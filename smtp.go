@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// base64 encoded lines in email must not exceed 76 characters
+const mimeLineLen = 76
+
+type smtpNotifier struct {
+	host string
+	from string
+	to   []string
+}
+
+// lineBreaker splits written data to lines of mimeLineLen characters.
+type lineBreaker struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineBreaker) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := mimeLineLen - l.col
+		if n > len(p) {
+			n = len(p)
+		}
+
+		_, err := l.w.Write(p[:n])
+		if err != nil {
+			return written, err
+		}
+		written += n
+		l.col += n
+		p = p[n:]
+
+		if l.col == mimeLineLen {
+			_, err = io.WriteString(l.w, "\r\n")
+			if err != nil {
+				return written, err
+			}
+			l.col = 0
+		}
+	}
+
+	return written, nil
+}
+
+func (s *smtpNotifier) LogFormat() logFormat {
+	return logFormatRaw
+}
+
+func (s *smtpNotifier) SendLogs(ctx context.Context, n *notification) error {
+	subject := n.name
+	if n.pod != nil {
+		subject = fmt.Sprintf("%s/%s", n.pod.GetNamespace(), n.pod.GetName())
+	}
+	if len(n.containerName) > 0 {
+		subject = fmt.Sprintf("%s/%s", subject, n.containerName)
+	}
+	if len(n.reason) > 0 {
+		subject = fmt.Sprintf("%s terminated: %s", subject, n.reason)
+	}
+
+	msg := new(bytes.Buffer)
+	mw := multipart.NewWriter(msg)
+
+	s.writeHeaders(msg, subject)
+	fmt.Fprintf(msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.SendLogs] failed create text part: %s", err)
+	}
+	fmt.Fprintf(part, "%s\r\n", strings.Replace(n.caption, "\n", "\r\n", -1))
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": n.fileName()})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.SendLogs] failed create attachment part: %s", err)
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, &lineBreaker{w: part})
+	_, err = io.Copy(enc, n.logs)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.SendLogs] failed write attachment: %s", err)
+	}
+	enc.Close()
+
+	err = mw.Close()
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.SendLogs] failed close multipart writer: %s", err)
+	}
+
+	return s.send(ctx, msg.Bytes())
+}
+
+func (s *smtpNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	subject := "k8s-container-logs-sender"
+	if pod != nil {
+		subject = fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+	}
+
+	msg := new(bytes.Buffer)
+	s.writeHeaders(msg, subject)
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(text, "\n", "\r\n", -1))
+
+	return s.send(ctx, msg.Bytes())
+}
+
+func (s *smtpNotifier) writeHeaders(msg *bytes.Buffer, subject string) {
+	fmt.Fprintf(msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+}
+
+// send delivers message like smtp.SendMail, but connection is dialed and
+// bounded by ctx.
+func (s *smtpNotifier) send(ctx context.Context, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.host)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] invalid smtp host %s: %s", s.host, err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.host)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed dial %s: %s", s.host, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("[smtpNotifier.send] failed set deadline: %s", err)
+		}
+	}
+
+	// canceled context interrupts blocked reads and writes
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed create client: %s", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return fmt.Errorf("[smtpNotifier.send] failed start tls: %s", err)
+		}
+	}
+
+	username := os.Getenv("SMTP_USERNAME")
+	if len(username) > 0 {
+		err = c.Auth(smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host))
+		if err != nil {
+			return fmt.Errorf("[smtpNotifier.send] failed auth: %s", err)
+		}
+	}
+
+	err = c.Mail(s.from)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed set sender: %s", err)
+	}
+
+	for _, to := range s.to {
+		err = c.Rcpt(to)
+		if err != nil {
+			return fmt.Errorf("[smtpNotifier.send] failed add recipient %s: %s", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed start data: %s", err)
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed write message: %s", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("[smtpNotifier.send] failed send mail: %s", err)
+	}
+
+	// message is accepted, so failed quit must not cause resend
+	c.Quit()
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPSendContextDeadline(t *testing.T) {
+	// server accepts connection, but never greets client
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+
+	s := &smtpNotifier{host: l.Addr().String(), from: "sender@example.com", to: []string{"ops@example.com"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.SendMessage(ctx, nil, "text"); err == nil {
+		t.Fatal("SendMessage() error = nil, want deadline error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SendMessage() returned after %s, want it bounded by context deadline", elapsed)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// stabilizing is crash of container waiting until container stops
+// restarting.
+type stabilizing struct {
+	timer *time.Timer
+	// generation is increased on every crash, so fired timer of replaced
+	// crash is ignored
+	generation int
+	crashes    int
+	pod        *v1.Pod
+}
+
+// podStabilizing holds crashes waiting for stabilization of every container
+// of pod.
+type podStabilizing struct {
+	uid        types.UID
+	containers map[string]*stabilizing
+}
+
+var (
+	stabilizingMu sync.Mutex
+	// stabilizingPods holds crashes waiting for stabilization by pod key
+	stabilizingPods = map[string]*podStabilizing{}
+)
+
+// deferUntilStable delays sending of container crash logs until container
+// doesn't crash for --stabilize-window, every new crash restarts window.
+// Logs are sent at once when container crashed --stabilize-max-restarts
+// times within window. Deferred send is done with controller context and
+// isn't retried.
+func deferUntilStable(ctx context.Context, pod *v1.Pod, containerName string) {
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+	ctx = withFinalAttempt(ctx, true)
+
+	stabilizingMu.Lock()
+	defer stabilizingMu.Unlock()
+
+	p, ok := stabilizingPods[key]
+	if !ok || p.uid != pod.GetUID() {
+		p = &podStabilizing{uid: pod.GetUID(), containers: map[string]*stabilizing{}}
+		stabilizingPods[key] = p
+	}
+
+	s, ok := p.containers[containerName]
+	if !ok {
+		s = &stabilizing{}
+		p.containers[containerName] = s
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	s.generation++
+	s.crashes++
+	s.pod = pod
+
+	if stabilizeMaxRestarts > 0 && s.crashes >= stabilizeMaxRestarts {
+		klog.V(4).Infof("Container %s crashed %d times, send without waiting for stabilization", containerName, s.crashes)
+		delete(p.containers, containerName)
+		go sendStabilized(ctx, pod, containerName, s.crashes)
+		return
+	}
+
+	klog.V(4).Infof("Container %s crashed %d times, wait %s for stabilization", containerName, s.crashes, stabilizeWindow)
+
+	generation := s.generation
+	s.timer = time.AfterFunc(stabilizeWindow, func() {
+		stabilizingMu.Lock()
+		if p.containers[containerName] != s || s.generation != generation {
+			stabilizingMu.Unlock()
+			return
+		}
+		delete(p.containers, containerName)
+		stabilizingMu.Unlock()
+
+		sendStabilized(ctx, s.pod, containerName, s.crashes)
+	})
+}
+
+// sendStabilized sends logs of last container crash, container may be
+// already restarted, so its previous logs are sent then.
+func sendStabilized(ctx context.Context, pod *v1.Pod, containerName string, crashes int) {
+	current, err := clientset.CoreV1().Pods(pod.GetNamespace()).Get(ctx, pod.GetName(), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err) || err == nil && current.GetUID() != pod.GetUID():
+		klog.V(2).Infof("Skip stabilized crash of disappeared pod: %s, container: %s", pod.GetName(), containerName)
+		return
+	case err != nil:
+		klog.Errorf("[sendStabilized] failed get pod %s, send logs of last seen state: %s", pod.GetName(), err)
+		current = pod
+	}
+
+	if status := findContainerStatus(current, containerName); status != nil && status.State.Terminated == nil {
+		current = withLastTermination(current, containerName)
+	}
+
+	klog.Infof("Send logs from pod: %s, container: %s, stabilized after %d crashes", pod.GetName(), containerName, crashes)
+
+	err = sendContainerLogs(ctx, current, containerName, false)
+	if err != nil {
+		klog.Errorf("[sendStabilized] failed send container logs: %s", err)
+		recordSendError(pod, err)
+	}
+}
+
+// forgetStabilizing stops waiting for stabilization of deleted pod, its
+// logs are not available anymore.
+func forgetStabilizing(key string) {
+	stabilizingMu.Lock()
+	defer stabilizingMu.Unlock()
+
+	if p, ok := stabilizingPods[key]; ok {
+		for _, s := range p.containers {
+			s.timer.Stop()
+		}
+		delete(stabilizingPods, key)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	sentMu sync.Mutex
+	// sentTerminations holds finishedAt of terminations which logs are sent
+	sentTerminations = map[string]int64{}
+	sentDirty        bool
+)
+
+// terminationKey returns unique key of container termination.
+func terminationKey(pod *v1.Pod, containerStatus v1.ContainerStatus) string {
+	finishedAt := containerStatus.State.Terminated.FinishedAt.Unix()
+	return fmt.Sprintf("%s/%s/%d", pod.GetUID(), containerStatus.Name, finishedAt)
+}
+
+// claimTermination marks termination as sent, it returns false if
+// termination is already marked.
+func claimTermination(pod *v1.Pod, containerStatus v1.ContainerStatus) bool {
+	key := terminationKey(pod, containerStatus)
+
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	if _, ok := sentTerminations[key]; ok {
+		return false
+	}
+
+	sentTerminations[key] = containerStatus.State.Terminated.FinishedAt.Unix()
+	sentDirty = true
+
+	return true
+}
+
+// releaseTermination unmarks termination, so its logs may be sent again.
+func releaseTermination(pod *v1.Pod, containerStatus v1.ContainerStatus) {
+	sentMu.Lock()
+	delete(sentTerminations, terminationKey(pod, containerStatus))
+	sentMu.Unlock()
+}
+
+// pruneTerminations drops terminations which are out of --delay, they
+// will never be sent again.
+func pruneTerminations() {
+	now := time.Now().Unix()
+
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	for key, finishedAt := range sentTerminations {
+		if now-finishedAt >= delay {
+			delete(sentTerminations, key)
+			sentDirty = true
+		}
+	}
+}
+
+// loadState reads sent terminations from file, missing file is not an error.
+func loadState(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[loadState] failed read state file %s: %s", path, err)
+	}
+
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	err = json.Unmarshal(data, &sentTerminations)
+	if err != nil {
+		return fmt.Errorf("[loadState] failed parse state file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// saveState writes sent terminations to file if they were changed, failed
+// write keeps them changed, so they are written on next save.
+func saveState(path string) (err error) {
+	sentMu.Lock()
+	if !sentDirty {
+		sentMu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(sentTerminations)
+	// changes made during write are written on next save
+	sentDirty = false
+	sentMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			sentMu.Lock()
+			sentDirty = true
+			sentMu.Unlock()
+		}
+	}()
+
+	if err != nil {
+		return fmt.Errorf("[saveState] failed marshal state: %s", err)
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("[saveState] failed write state file %s: %s", tmp, err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("[saveState] failed rename state file %s: %s", tmp, err)
+	}
+
+	return nil
+}
+
+// flushState prunes sent terminations and saves them to --state-file.
+func flushState() {
+	pruneTerminations()
+
+	if len(stateFile) == 0 {
+		return
+	}
+
+	err := saveState(stateFile)
+	if err != nil {
+		klog.Errorf("[flushState] %s", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveStateKeepsChangesOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sentMu.Lock()
+	savedTerminations, savedDirty := sentTerminations, sentDirty
+	sentTerminations = map[string]int64{"uid/app/1": 1}
+	sentDirty = true
+	sentMu.Unlock()
+	defer func() {
+		sentMu.Lock()
+		sentTerminations, sentDirty = savedTerminations, savedDirty
+		sentMu.Unlock()
+	}()
+
+	path := filepath.Join(dir, "missing", "state.json")
+	if err := saveState(path); err == nil {
+		t.Fatal("saveState() error = nil, want error for missing directory")
+	}
+	if !sentDirty {
+		t.Fatal("sentDirty = false after failed save, want true")
+	}
+
+	path = filepath.Join(dir, "state.json")
+	if err := saveState(path); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+	if sentDirty {
+		t.Error("sentDirty = true after successful save, want false")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("state file is not written: %v", err)
+	}
+}
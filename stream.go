@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// maxStreamLineLen is max length of streamed log line.
+const maxStreamLineLen = 1024 * 1024
+
+// streamLogs follows logs of pod container and sends accumulated lines
+// every --live-flush-interval until --live-duration elapsed, stream ended
+// or process interrupted. Pod is set as namespace/name, log filters are
+// applied to sent lines.
+func streamLogs(key string, containerName string) error {
+	podNamespace, podName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("[streamLogs] invalid pod %s, expected format: namespace/pod: %s", key, err)
+	}
+	if len(podNamespace) == 0 {
+		podNamespace = namespace
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), liveDuration)
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pod, err := clientset.CoreV1().Pods(podNamespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("[streamLogs] failed get pod %s: %s", key, err)
+	}
+
+	if len(containerName) == 0 {
+		containerName = pod.Spec.Containers[0].Name
+	}
+
+	podLogs, err := openPodLogs(ctx, pod, &v1.PodLogOptions{
+		Container: containerName,
+		Follow:    true,
+		TailLines: tailLines,
+	})
+	if err != nil {
+		return fmt.Errorf("[streamLogs] failed create stream: %s", err)
+	}
+	defer podLogs.Close()
+
+	var mu sync.Mutex
+	buf := new(bytes.Buffer)
+
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(podLogs)
+		scanner.Buffer(make([]byte, 64*1024), maxStreamLineLen)
+		for scanner.Scan() {
+			mu.Lock()
+			buf.Write(scanner.Bytes())
+			buf.WriteByte('\n')
+			mu.Unlock()
+		}
+		done <- scanner.Err()
+	}()
+
+	// flush sends accumulated lines, context of stream may be already
+	// canceled, so last lines are sent with own context
+	flush := func() {
+		mu.Lock()
+		logs := buf
+		buf = new(bytes.Buffer)
+		mu.Unlock()
+
+		if isLogFilterEnabled() {
+			logs = filterLogLines(logs)
+		}
+
+		if logs.Len() == 0 {
+			return
+		}
+
+		err := sendNotification(context.Background(), &notification{
+			pod:           pod,
+			containerName: containerName,
+			name:          notificationName(pod, containerName),
+			caption:       buildCaption(pod, containerName),
+			logs:          truncateLogs(redactLogs(logs), maxBytes),
+		})
+		if err != nil {
+			klog.Errorf("[streamLogs] failed send logs: %s", err)
+		}
+	}
+
+	ticker := time.NewTicker(liveFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case err := <-done:
+			flush()
+			if err != nil && ctx.Err() == nil {
+				return fmt.Errorf("[streamLogs] failed read stream: %s", err)
+			}
+			return nil
+		}
+	}
+}
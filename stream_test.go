@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStreamLogs(t *testing.T) {
+	pod := newTestPod("team", "stream", runningStatus("app"))
+	pod.Spec.Containers = []v1.Container{{Name: "app"}}
+
+	recorder, restore := setupTest(t, pod)
+	defer restore()
+
+	savedLiveDuration, savedLiveFlushInterval, savedExclude := liveDuration, liveFlushInterval, logExcludeRegexp
+	defer func() {
+		liveDuration, liveFlushInterval, logExcludeRegexp = savedLiveDuration, savedLiveFlushInterval, savedExclude
+	}()
+	liveDuration = time.Minute
+	liveFlushInterval = time.Minute
+	logExcludeRegexp = regexp.MustCompile("health")
+
+	// line longer than default scanner buffer
+	long := strings.Repeat("x", 128*1024)
+	openPodLogs = func(ctx context.Context, pod *v1.Pod, opts *v1.PodLogOptions) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("started\nGET /health\n" + long + "\n")), nil
+	}
+
+	if err := streamLogs("team/stream", ""); err != nil {
+		t.Fatalf("streamLogs() error = %v", err)
+	}
+
+	want := "started\n" + long + "\n"
+	if len(recorder.logs) != 1 || recorder.logs[0] != want {
+		t.Errorf("sent logs = %d, want single filtered logs", len(recorder.logs))
+	}
+}
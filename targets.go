@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// logForwardTargetResource is resource of LogForwardTarget custom
+// resource, its definition is in logforwardtarget.yaml.
+var logForwardTargetResource = schema.GroupVersionResource{
+	Group:    "logs-sender.io",
+	Version:  "v1alpha1",
+	Resource: "logforwardtargets",
+}
+
+// forwardTarget is compiled LogForwardTarget, empty pattern matches any
+// name and empty chat keeps routes from flags.
+type forwardTarget struct {
+	name             string
+	namespace        string
+	podPattern       *regexp.Regexp
+	containerPattern *regexp.Regexp
+	dest             destination
+	hasDest          bool
+}
+
+var (
+	forwardTargetsMu sync.RWMutex
+	// forwardTargets holds targets from LogForwardTarget resources, they
+	// replace pod and container name filters when --watch-targets is set
+	forwardTargets []forwardTarget
+)
+
+// parseForwardTarget compiles LogForwardTarget, target is scoped to
+// namespace of resource. Other namespace in spec is allowed only with
+// --allow-cross-namespace-targets, so tenant can't forward logs of pods
+// from namespaces it doesn't own.
+func parseForwardTarget(obj *unstructured.Unstructured) (forwardTarget, error) {
+	target := forwardTarget{
+		name:      fmt.Sprintf("%s/%s", obj.GetNamespace(), obj.GetName()),
+		namespace: obj.GetNamespace(),
+	}
+
+	spec, _, err := unstructured.NestedStringMap(obj.Object, "spec")
+	if err != nil {
+		return target, fmt.Errorf("[parseForwardTarget] invalid spec: %s", err)
+	}
+
+	if ns := spec["namespace"]; len(ns) > 0 && ns != target.namespace {
+		if !allowCrossNamespaceTargets {
+			return target, fmt.Errorf("[parseForwardTarget] namespace %s differs from namespace of resource, --allow-cross-namespace-targets is not set", ns)
+		}
+		target.namespace = ns
+	}
+
+	if pattern := spec["podNamePattern"]; len(pattern) > 0 {
+		target.podPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return target, fmt.Errorf("[parseForwardTarget] invalid pod name pattern: %s", err)
+		}
+	}
+
+	if pattern := spec["containerNamePattern"]; len(pattern) > 0 {
+		target.containerPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return target, fmt.Errorf("[parseForwardTarget] invalid container name pattern: %s", err)
+		}
+	}
+
+	if chat := spec["chat"]; len(chat) > 0 {
+		target.dest, err = parseDestination(chat)
+		if err != nil {
+			return target, fmt.Errorf("[parseForwardTarget] invalid chat: %s", err)
+		}
+		target.hasDest = true
+	}
+
+	return target, nil
+}
+
+// reconcileForwardTargets compiles all resources from store and replaces
+// targets at once, invalid resources are skipped.
+func reconcileForwardTargets(store cache.Store) {
+	var targets []forwardTarget
+
+	for _, obj := range store.List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		target, err := parseForwardTarget(u)
+		if err != nil {
+			klog.Errorf("[reconcileForwardTargets] skip target %s/%s: %s", u.GetNamespace(), u.GetName(), err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+
+	forwardTargetsMu.Lock()
+	forwardTargets = targets
+	forwardTargetsMu.Unlock()
+
+	klog.Infof("Log forward targets updated, targets: %d", len(targets))
+}
+
+// matchForwardTarget returns first target matched by pod and container,
+// empty container name matches target by pod only.
+func matchForwardTarget(pod *v1.Pod, containerName string) (forwardTarget, bool) {
+	forwardTargetsMu.RLock()
+	defer forwardTargetsMu.RUnlock()
+
+	for _, target := range forwardTargets {
+		if target.namespace != pod.GetNamespace() {
+			continue
+		}
+
+		if target.podPattern != nil && !target.podPattern.MatchString(pod.GetName()) {
+			continue
+		}
+
+		if len(containerName) > 0 && target.containerPattern != nil && !target.containerPattern.MatchString(containerName) {
+			continue
+		}
+
+		return target, true
+	}
+
+	return forwardTarget{}, false
+}
+
+// isTargetContainer reports whether container is matched by any target
+// of pod.
+func isTargetContainer(pod *v1.Pod, containerName string) bool {
+	if target, ok := matchForwardTarget(pod, containerName); ok {
+		klog.V(4).Infof("Container %s is checked, matched target: %s", containerName, target.name)
+		return true
+	}
+
+	klog.V(4).Infof("Container %s is skipped, no target matched", containerName)
+	return false
+}
+
+// targetRoute returns destination of target matched by pod container, so
+// container is routed by the same target which selected it.
+func targetRoute(pod *v1.Pod, containerName string) (destination, bool) {
+	if !watchTargets {
+		return destination{}, false
+	}
+
+	target, ok := matchForwardTarget(pod, containerName)
+	if !ok || !target.hasDest {
+		return destination{}, false
+	}
+
+	return target.dest, true
+}
+
+// newTargetInformer returns informer of LogForwardTarget resources in
+// namespace, all namespaces are watched if namespace is empty. Targets
+// are rebuilt on every change.
+func newTargetInformer(config *rest.Config, namespace string) (cache.Controller, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("[newTargetInformer] failed create dynamic client: %s", err)
+	}
+
+	resource := client.Resource(logForwardTargetResource).Namespace(namespace)
+	targetListWatcher := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return resource.List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return resource.Watch(context.TODO(), options)
+		},
+	}
+
+	var store cache.Store
+	store, informer := cache.NewInformer(targetListWatcher, &unstructured.Unstructured{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			reconcileForwardTargets(store)
+		},
+		UpdateFunc: func(old interface{}, new interface{}) {
+			reconcileForwardTargets(store)
+		},
+		DeleteFunc: func(obj interface{}) {
+			reconcileForwardTargets(store)
+		},
+	})
+
+	return informer, nil
+}
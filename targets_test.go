@@ -0,0 +1,106 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestTarget(namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetNamespace(namespace)
+	obj.SetName("target")
+
+	return obj
+}
+
+func TestParseForwardTargetNamespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		allow   bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "namespace of resource",
+			spec: map[string]interface{}{},
+			want: "team-a",
+		},
+		{
+			name: "the same namespace in spec",
+			spec: map[string]interface{}{"namespace": "team-a"},
+			want: "team-a",
+		},
+		{
+			name:    "other namespace in spec",
+			spec:    map[string]interface{}{"namespace": "team-b"},
+			wantErr: true,
+		},
+		{
+			name:  "other namespace in spec allowed",
+			spec:  map[string]interface{}{"namespace": "team-b"},
+			allow: true,
+			want:  "team-b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := allowCrossNamespaceTargets
+			defer func() { allowCrossNamespaceTargets = saved }()
+			allowCrossNamespaceTargets = tt.allow
+
+			target, err := parseForwardTarget(newTestTarget("team-a", tt.spec))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseForwardTarget() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseForwardTarget() error = %v", err)
+			}
+
+			if target.namespace != tt.want {
+				t.Errorf("parseForwardTarget() namespace = %q, want %q", target.namespace, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetRouteByContainer(t *testing.T) {
+	savedWatchTargets, savedForwardTargets := watchTargets, forwardTargets
+	defer func() {
+		watchTargets, forwardTargets = savedWatchTargets, savedForwardTargets
+	}()
+
+	watchTargets = true
+	forwardTargets = []forwardTarget{
+		{name: "team/app", namespace: "team", containerPattern: regexp.MustCompile("^app$"), dest: destination{chatID: 1}, hasDest: true},
+		{name: "team/worker", namespace: "team", containerPattern: regexp.MustCompile("^worker$"), dest: destination{chatID: 2}, hasDest: true},
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "api"}}
+
+	tests := []struct {
+		containerName string
+		want          destination
+		wantOK        bool
+	}{
+		{containerName: "app", want: destination{chatID: 1}, wantOK: true},
+		{containerName: "worker", want: destination{chatID: 2}, wantOK: true},
+		{containerName: "", want: destination{chatID: 1}, wantOK: true},
+		{containerName: "sidecar"},
+	}
+
+	for _, tt := range tests {
+		got, ok := targetRoute(pod, tt.containerName)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("targetRoute(%q) = %+v, %v, want %+v, %v", tt.containerName, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// teams rejects messages larger than 28KB, the limit is in bytes
+const teamsMaxTextLen = 20000
+
+var logSnippetSeparator = []byte("...\n")
+
+type teamsNotifier struct {
+	webhookURL string
+}
+
+// teamsMessageCard is legacy connector card, it is accepted by incoming
+// webhook of any channel.
+type teamsMessageCard struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+// logSnippet returns first and last lines of logs separated by "...",
+// logs not longer than twice lines are returned as is.
+func logSnippet(logs *bytes.Buffer, lines int) []byte {
+	all := splitLogLines(logs.Bytes())
+	if lines <= 0 || len(all) <= 2*lines {
+		return logs.Bytes()
+	}
+
+	snippet := bytes.Join(all[:lines], nil)
+	snippet = append(snippet, logSnippetSeparator...)
+
+	return append(snippet, bytes.Join(all[len(all)-lines:], nil)...)
+}
+
+// LogFormat returns text format, caption is the first lines of logs.
+func (t *teamsNotifier) LogFormat() logFormat {
+	return logFormatText
+}
+
+// teamsPre escapes text and wraps it in <pre>, escaped text is cut to fit
+// max bytes together with tags, so neither closing tag nor html entity is
+// cut.
+func teamsPre(text string, max int) string {
+	escaped := html.EscapeString(text)
+
+	max -= len("<pre></pre>")
+	if max < 0 {
+		max = 0
+	}
+
+	if len(escaped) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(escaped[cut]) {
+			cut--
+		}
+		// entity is cut if there is no ";" after its last "&"
+		if i := strings.LastIndexByte(escaped[:cut], '&'); i >= 0 && !strings.Contains(escaped[i:cut], ";") {
+			cut = i
+		}
+		escaped = escaped[:cut]
+	}
+
+	return "<pre>" + escaped + "</pre>"
+}
+
+func (t *teamsNotifier) SendLogs(ctx context.Context, n *notification) error {
+	return t.post(ctx, teamsMessageCard{
+		Type:    "MessageCard",
+		Context: "http://schema.org/extensions",
+		Summary: n.name,
+		Title:   n.name,
+		Text:    teamsPre(string(logSnippet(n.logs, teamsSnippetLines)), teamsMaxTextLen),
+	})
+}
+
+func (t *teamsNotifier) SendMessage(ctx context.Context, pod *v1.Pod, text string) error {
+	return t.post(ctx, teamsMessageCard{
+		Type:    "MessageCard",
+		Context: "http://schema.org/extensions",
+		Summary: truncateText(text, 100),
+		Text:    teamsPre(text, teamsMaxTextLen),
+	})
+}
+
+func (t *teamsNotifier) post(ctx context.Context, card teamsMessageCard) error {
+	payload, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("[teamsNotifier.post] failed marshal payload: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhookURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("[teamsNotifier.post] failed create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Transport: notifierTransport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("[teamsNotifier.post] failed send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("[teamsNotifier.post] unexpected response %s: %s", resp.Status, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTeamsPre(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{name: "fits", text: "a < b", max: 100, want: "<pre>a &lt; b</pre>"},
+		{name: "cut plain text", text: "abcdef", max: 14, want: "<pre>abc</pre>"},
+		{name: "entity is not cut", text: "ab<cd", max: 16, want: "<pre>ab</pre>"},
+		{name: "whole entity fits", text: "ab<cd", max: 17, want: "<pre>ab&lt;</pre>"},
+		{name: "rune is not cut", text: "aпривет", max: 14, want: "<pre>aп</pre>"},
+		{name: "no room", text: "abc", max: 5, want: "<pre></pre>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := teamsPre(tt.text, tt.max)
+			if got != tt.want {
+				t.Errorf("teamsPre(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+			}
+			if len(got) > tt.max && tt.max >= len("<pre></pre>") {
+				t.Errorf("teamsPre(%q, %d) is %d bytes, more than max", tt.text, tt.max, len(got))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("teamsPre(%q, %d) = %q is not valid utf-8", tt.text, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestTeamsPreLongLogs(t *testing.T) {
+	logs := strings.Repeat("<error> & \"quoted\" пример\n", 2000)
+
+	got := teamsPre(logs, teamsMaxTextLen)
+	if len(got) > teamsMaxTextLen {
+		t.Errorf("teamsPre() is %d bytes, more than %d", len(got), teamsMaxTextLen)
+	}
+	if !strings.HasSuffix(got, "</pre>") {
+		t.Errorf("teamsPre() = %q..., want closing </pre>", got[len(got)-20:])
+	}
+}
@@ -2,22 +2,388 @@ package main
 
 import (
 	"bytes"
-	// "errors"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"html"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// public bot api server, its documents are limited by 50MB
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	// telegram rejects document captions longer than 1024 characters
+	telegramMaxCaptionLen = 1024
+	// telegram rejects messages longer than 4096 characters
+	telegramMaxMessageLen = 4096
 )
 
-func sendLogsToTelegram(chatID int64, logs *bytes.Buffer, prefix string) error {
+// truncateText cuts text to max characters.
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+
+	return text
+}
+
+// telegramTextLen returns length of text in UTF-16 code units, telegram
+// counts characters of its limits in them.
+func telegramTextLen(text string) int {
+	n := 0
+	for _, r := range text {
+		n += telegramRuneLen(r)
+	}
+
+	return n
+}
+
+// truncateTelegramText cuts text to max UTF-16 code units.
+func truncateTelegramText(text string, max int) string {
+	n := 0
+	for i, r := range text {
+		n += telegramRuneLen(r)
+		if n > max {
+			return text[:i]
+		}
+	}
+
+	return text
+}
+
+// telegramRuneLen returns number of UTF-16 code units of rune, runes out
+// of basic multilingual plane take surrogate pair.
+func telegramRuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
+
+// errSendRateLimited is returned for message exceeded --send-rate, pod
+// is requeued, so logs are sent on retry instead of being lost.
+var errSendRateLimited = errors.New("send rate limit exceeded")
+
+// chatLimiter limits sends to single chat and counts limited messages.
+type chatLimiter struct {
+	limiter *rate.Limiter
+	limited uint64
+}
+
+var (
+	chatLimitersMu sync.Mutex
+	chatLimiters   = map[int64]*chatLimiter{}
+)
+
+// allowSend returns errSendRateLimited if n messages may not be sent to
+// chat now because of --send-rate, every message takes own token and
+// tokens are taken all or none, so messages aren't sent partially.
+func allowSend(chatID int64, n int) error {
+	if sendRate <= 0 {
+		return nil
+	}
+
+	chatLimitersMu.Lock()
+	defer chatLimitersMu.Unlock()
+
+	l, ok := chatLimiters[chatID]
+	if !ok {
+		l = &chatLimiter{limiter: rate.NewLimiter(rate.Limit(sendRate/60), sendBurst)}
+		chatLimiters[chatID] = l
+	}
+
+	if l.limiter.AllowN(time.Now(), n) {
+		return nil
+	}
+
+	l.limited += uint64(n)
+	recordRateLimited()
+	klog.Warningf("Send rate limit exceeded for chat: %d, limited messages: %d", chatID, l.limited)
+
+	return fmt.Errorf("[allowSend] chat %d: %w", chatID, errSendRateLimited)
+}
+
+// telegramEndpointTransport redirects requests of bot api library, which
+// has public api endpoint hardcoded, to --telegram-api-url.
+type telegramEndpointTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *telegramEndpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	req.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	req.Host = t.base.Host
+
+	return t.next.RoundTrip(req)
+}
+
+// contextTransport binds requests of bot api library, which doesn't accept
+// context, to context.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// newTelegramBot returns bot api client authorized by TG_BOT_TOKEN, its
+// requests are cancelled with context.
+func newTelegramBot(ctx context.Context) (*tgbotapi.BotAPI, error) {
 	token := os.Getenv("TG_BOT_TOKEN")
 
-	bot, err := tgbotapi.NewBotAPI(token)
+	var transport http.RoundTripper = &contextTransport{ctx: ctx, next: notifierTransport}
+	if telegramAPIBase != nil {
+		transport = &telegramEndpointTransport{base: telegramAPIBase, next: transport}
+	}
+	client := &http.Client{Transport: transport}
+
+	return tgbotapi.NewBotAPIWithClient(token, client)
+}
+
+// validateTelegramChats checks bot token and that bot has access to every
+// chat from the list.
+func validateTelegramChats(chatIDs []int64) error {
+	bot, err := newTelegramBot(context.TODO())
+	if err != nil {
+		return fmt.Errorf("[validateTelegramChats] failed call getMe, check TG_BOT_TOKEN: %s", err)
+	}
+
+	for _, id := range chatIDs {
+		_, err = bot.GetChat(tgbotapi.ChatConfig{ChatID: id})
+		if err != nil {
+			return fmt.Errorf("[validateTelegramChats] failed call getChat for chat %d, check bot %s is member of chat: %s", id, bot.Self.UserName, err)
+		}
+	}
+
+	return nil
+}
+
+var markdownV2Replacer = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// inside of MarkdownV2 code block only backslash and backtick are escaped
+var markdownV2CodeReplacer = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+// formatTelegramLogs returns logs text with caption formatted for
+// --telegram-parse-mode, logs are wrapped to code block.
+func formatTelegramLogs(caption string, logs string) string {
+	var text string
+
+	switch telegramParseMode {
+	case "HTML":
+		text = fmt.Sprintf("<pre>%s</pre>", html.EscapeString(logs))
+		if len(caption) > 0 {
+			text = fmt.Sprintf("%s\n\n%s", html.EscapeString(caption), text)
+		}
+	case "MarkdownV2":
+		text = fmt.Sprintf("```\n%s\n```", markdownV2CodeReplacer.Replace(logs))
+		if len(caption) > 0 {
+			text = fmt.Sprintf("%s\n\n%s", markdownV2Replacer.Replace(caption), text)
+		}
+	default:
+		text = logs
+		if len(caption) > 0 {
+			text = fmt.Sprintf("%s\n\n%s", caption, text)
+		}
+	}
+
+	return text
+}
+
+const (
+	// part number header and its escaping are reserved in every part
+	telegramPartHeaderReserve = 32
+	// long lines are split to pieces, so escaped piece always fits message
+	telegramMaxPieceLen = 500
+)
+
+// splitTelegramParts splits logs to parts, every part formatted with part
+// header fits single message. Lines are not split unless line is longer
+// than telegramMaxPieceLen. Caption is added to first part, first part
+// holds only caption if there is no room for logs.
+func splitTelegramParts(caption string, logs string) []string {
+	fits := func(caption string, chunk string) bool {
+		return telegramTextLen(formatTelegramLogs(caption, chunk))+telegramPartHeaderReserve <= telegramMaxMessageLen
+	}
+
+	var parts []string
+	var current strings.Builder
+	for _, line := range splitLogLines([]byte(logs)) {
+		runes := []rune(string(line))
+		for len(runes) > 0 {
+			n := len(runes)
+			if n > telegramMaxPieceLen {
+				n = telegramMaxPieceLen
+			}
+			piece := string(runes[:n])
+			runes = runes[n:]
+
+			partCaption := ""
+			if len(parts) == 0 {
+				partCaption = caption
+			}
+			if fits(partCaption, current.String()+piece) {
+				current.WriteString(piece)
+				continue
+			}
+
+			parts = append(parts, current.String())
+			current.Reset()
+			current.WriteString(piece)
+		}
+	}
+
+	if current.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
+
+// telegramParts returns logs split into messages with part numbers, only
+// first part and last --max-message-parts minus one parts are returned if
+// there are more parts, so both caption and end of logs are kept.
+func telegramParts(caption string, logs string) []string {
+	parts := splitTelegramParts(truncateTelegramText(caption, telegramMaxCaptionLen), logs)
+	total := len(parts)
+
+	indexes := make([]int, 0, total)
+	for i := range parts {
+		if i == 0 || i >= total-(maxMessageParts-1) {
+			indexes = append(indexes, i)
+		}
+	}
+	if skipped := total - len(indexes); skipped > 0 {
+		klog.V(2).Infof("Skip %d of %d log parts, --max-message-parts is %d", skipped, total, maxMessageParts)
+	}
+
+	messages := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		partCaption := fmt.Sprintf("[%d/%d]", i+1, total)
+		if i == 0 && len(caption) > 0 {
+			partCaption = fmt.Sprintf("%s\n%s", partCaption, truncateTelegramText(caption, telegramMaxCaptionLen))
+		}
+
+		messages = append(messages, formatTelegramLogs(partCaption, parts[i]))
+	}
+
+	return messages
+}
+
+// postTelegramMessage sends text message to destination chat, parse mode
+// may be empty for plain text.
+func postTelegramMessage(bot *tgbotapi.BotAPI, dest destination, text string, parseMode string) error {
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(dest.chatID, 10))
+	params.Set("text", text)
+	if len(parseMode) > 0 {
+		params.Set("parse_mode", parseMode)
+	}
+	if dest.topicID != 0 {
+		params.Set("message_thread_id", strconv.FormatInt(dest.topicID, 10))
+	}
+
+	_, err := bot.MakeRequest("sendMessage", params)
+	if err != nil {
+		return fmt.Errorf("[postTelegramMessage] failed send message to tg: %s", err)
+	}
+
+	return nil
+}
+
+func sendMessageToTelegram(ctx context.Context, dest destination, text string) error {
+	if err := allowSend(dest.chatID, 1); err != nil {
+		return err
+	}
+
+	bot, err := newTelegramBot(ctx)
+	if err != nil {
+		return fmt.Errorf("[sendMessageToTelegram] failed create tg bot api connection: %s", err)
+	}
+
+	return postTelegramMessage(bot, dest, truncateTelegramText(text, telegramMaxMessageLen), "")
+}
+
+// sendLogsToTelegram sends logs as text messages or document. Sent parts
+// of logs split to several messages are remembered by key, so retry of
+// failed part doesn't send previous parts again, empty key disables it.
+func sendLogsToTelegram(ctx context.Context, dest destination, logs *bytes.Buffer, logFileName string, caption string, key string) error {
+	// small logs are sent as text messages to be readable without download
+	var messages []string
+	if messageThresholdBytes > 0 && logs.Len() <= messageThresholdBytes {
+		text := formatTelegramLogs(caption, logs.String())
+		switch {
+		case telegramTextLen(text) <= telegramMaxMessageLen:
+			messages = []string{text}
+		case maxMessageParts > 0:
+			messages = telegramParts(caption, logs.String())
+		}
+	}
+
+	// logs split differently on retry are sent again from first part
+	partsKey := ""
+	if len(key) > 0 && len(messages) > 1 {
+		partsKey = fmt.Sprintf("telegram-parts/%d/%s", len(messages), key)
+	}
+	sent := delivered(partsKey)
+	if sent == nil {
+		sent = map[int]bool{}
+	}
+
+	tokens := len(messages) - len(sent)
+	if tokens == 0 {
+		tokens = 1
+	}
+	if err := allowSend(dest.chatID, tokens); err != nil {
+		return err
+	}
+
+	bot, err := newTelegramBot(ctx)
 	if err != nil {
 		return fmt.Errorf("[sendLogsToTelegram] failed create tg bot api connection: %s", err)
 	}
 
-	logFileName := fmt.Sprintf("%s_%d.log", prefix, time.Now().Unix())
+	for i, text := range messages {
+		if sent[i] {
+			continue
+		}
+
+		err = postTelegramMessage(bot, dest, text, telegramParseMode)
+		if err != nil {
+			if len(partsKey) > 0 {
+				rememberDelivery(partsKey, sent, len(messages))
+			}
+			return fmt.Errorf("[sendLogsToTelegram] failed send message %d of %d: %s", i+1, len(messages), err)
+		}
+		sent[i] = true
+	}
+	if len(messages) > 0 {
+		if len(partsKey) > 0 {
+			rememberDelivery(partsKey, sent, len(messages))
+		}
+		return nil
+	}
+
 	logFile, err := os.Create(logFileName)
 	if err != nil {
 		return fmt.Errorf("[sendLogsToTelegram] failed create log file %s: %s", logFileName, err)
@@ -32,9 +398,17 @@ func sendLogsToTelegram(chatID int64, logs *bytes.Buffer, prefix string) error {
 
 	logFile.Close()
 
-	msg := tgbotapi.NewDocumentUpload(chatID, logFileName)
+	params := map[string]string{
+		"chat_id": strconv.FormatInt(dest.chatID, 10),
+	}
+	if dest.topicID != 0 {
+		params["message_thread_id"] = strconv.FormatInt(dest.topicID, 10)
+	}
+	if len(caption) > 0 {
+		params["caption"] = truncateTelegramText(caption, telegramMaxCaptionLen)
+	}
 
-	_, err = bot.Send(msg)
+	_, err = bot.UploadFile("sendDocument", params, "document", logFileName)
 	if err != nil {
 		return fmt.Errorf("[sendLogsToTelegram] failed send message to tg: %s", err)
 	}
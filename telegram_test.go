@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAllowSendTakesTokenPerMessage(t *testing.T) {
+	savedRate, savedBurst := sendRate, sendBurst
+	defer func() { sendRate, sendBurst = savedRate, savedBurst }()
+	sendRate, sendBurst = 1, 3
+
+	const chatID = -100500
+	defer func() {
+		chatLimitersMu.Lock()
+		delete(chatLimiters, chatID)
+		chatLimitersMu.Unlock()
+	}()
+
+	if err := allowSend(chatID, 2); err != nil {
+		t.Fatalf("allowSend(2) error = %v", err)
+	}
+
+	// parts are allowed all or none
+	if err := allowSend(chatID, 2); !errors.Is(err, errSendRateLimited) {
+		t.Errorf("allowSend(2) error = %v, want %v", err, errSendRateLimited)
+	}
+
+	if err := allowSend(chatID, 1); err != nil {
+		t.Errorf("allowSend(1) error = %v, want last token", err)
+	}
+}
+
+func TestSendLogsToTelegramResumesParts(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	fail := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}}`))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// second part fails once
+		if len(sent) == 1 && fail {
+			fail = false
+			w.Write([]byte(`{"ok":false,"error_code":500,"description":"unavailable"}`))
+			return
+		}
+
+		sent = append(sent, r.FormValue("text"))
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1}}}`))
+	}))
+	defer server.Close()
+
+	savedAPIBase, savedThreshold, savedMaxParts, savedParseMode := telegramAPIBase, messageThresholdBytes, maxMessageParts, telegramParseMode
+	defer func() {
+		telegramAPIBase, messageThresholdBytes, maxMessageParts, telegramParseMode = savedAPIBase, savedThreshold, savedMaxParts, savedParseMode
+	}()
+	telegramAPIBase, _ = url.Parse(server.URL)
+	messageThresholdBytes, maxMessageParts, telegramParseMode = 1<<20, 3, ""
+
+	logs := strings.Repeat(strings.Repeat("x", 99)+"\n", 100)
+	send := func() error {
+		return sendLogsToTelegram(context.Background(), destination{chatID: 1}, bytes.NewBufferString(logs), "logs.txt", "caption", "uid/parts")
+	}
+
+	if err := send(); err == nil {
+		t.Fatal("sendLogsToTelegram() error = nil, want error of second part")
+	}
+	if err := send(); err != nil {
+		t.Fatalf("sendLogsToTelegram() retry error = %v", err)
+	}
+
+	if len(sent) != 3 {
+		t.Fatalf("sent %d messages, want 3 parts each sent once", len(sent))
+	}
+	for i, text := range sent {
+		if !strings.HasPrefix(text, fmt.Sprintf("[%d/", i+1)) {
+			t.Errorf("message %d starts with %q, want part %d", i, text[:10], i+1)
+		}
+	}
+}
+
+func TestTelegramTextLen(t *testing.T) {
+	// emoji out of basic multilingual plane takes two UTF-16 code units
+	text := "ok \U0001F525"
+	if got := telegramTextLen(text); got != 5 {
+		t.Errorf("telegramTextLen(%q) = %d, want 5", text, got)
+	}
+	if got := truncateTelegramText(text, 4); got != "ok " {
+		t.Errorf("truncateTelegramText(%q, 4) = %q, want %q", text, got, "ok ")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// captionData holds fields available in --caption-template and
+// --filename-template.
+type captionData struct {
+	Namespace  string
+	Pod        string
+	Container  string
+	Reason     string
+	ExitCode   int32
+	Message    string
+	FinishedAt time.Time
+	Image      string
+}
+
+var (
+	captionTemplate  *template.Template
+	fileNameTemplate *template.Template
+)
+
+// parseTemplate parses template and checks it may be rendered with data,
+// so reference to unknown field fails at startup.
+func parseTemplate(name string, text string, data interface{}) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("[parseTemplate] failed parse %s template: %s", name, err)
+	}
+
+	err = tmpl.Execute(new(strings.Builder), data)
+	if err != nil {
+		return nil, fmt.Errorf("[parseTemplate] failed render %s template: %s", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// containerCaptionData returns template fields of pod container.
+func containerCaptionData(pod *v1.Pod, containerName string) captionData {
+	data := captionData{
+		Namespace: pod.GetNamespace(),
+		Pod:       pod.GetName(),
+		Container: containerName,
+	}
+
+	if containerStatus := findContainerStatus(pod, containerName); containerStatus != nil {
+		data.Image = containerStatus.Image
+		if terminated := containerStatus.State.Terminated; terminated != nil {
+			data.Reason = terminated.Reason
+			data.ExitCode = terminated.ExitCode
+			data.Message = truncateText(redactText(strings.TrimSpace(terminated.Message)), maxTerminationMessageLen)
+			data.FinishedAt = terminated.FinishedAt.Time
+		}
+	}
+
+	return data
+}
+
+// containerCaption returns caption of container logs rendered by
+// --caption-template or metadata header if template is not set.
+func containerCaption(pod *v1.Pod, containerName string) string {
+	if captionTemplate == nil {
+		return buildCaption(pod, containerName)
+	}
+
+	var b strings.Builder
+	err := captionTemplate.Execute(&b, containerCaptionData(pod, containerName))
+	if err != nil {
+		return fmt.Sprintf("failed render caption template: %s\n%s", err, buildCaption(pod, containerName))
+	}
+
+	return b.String()
+}
+
+// podCaption returns caption of several pod containers logs, template is
+// rendered for every container.
+func podCaption(pod *v1.Pod, containerNames []string) string {
+	if captionTemplate == nil {
+		return buildCaption(pod, containerNames...)
+	}
+
+	captions := make([]string, 0, len(containerNames))
+	for _, containerName := range containerNames {
+		captions = append(captions, containerCaption(pod, containerName))
+	}
+
+	return strings.Join(captions, "\n")
+}
+
+// templateFileName returns file name base rendered by --filename-template,
+// empty name is returned if template is not set or failed.
+func templateFileName(pod *v1.Pod, containerName string) string {
+	if fileNameTemplate == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	err := fileNameTemplate.Execute(&b, containerCaptionData(pod, containerName))
+	if err != nil {
+		klog.Errorf("[templateFileName] failed render file name of pod %s: %s", pod.GetName(), err)
+		return ""
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// nodeLogLinkData holds fields available in --node-log-link-template.
+type nodeLogLinkData struct {
+	Node      string
+	Pod       string
+	Namespace string
+}
+
+var nodeLogLink *template.Template
+
+// withNodeLogLink appends link rendered by --node-log-link-template to
+// caption.
+func withNodeLogLink(pod *v1.Pod, caption string) string {
+	if nodeLogLink == nil {
+		return caption
+	}
+
+	var b strings.Builder
+	err := nodeLogLink.Execute(&b, nodeLogLinkData{
+		Node:      pod.Spec.NodeName,
+		Pod:       pod.GetName(),
+		Namespace: pod.GetNamespace(),
+	})
+	if err != nil {
+		klog.Errorf("[withNodeLogLink] failed render node log link of pod %s: %s", pod.GetName(), err)
+		return caption
+	}
+
+	link := strings.TrimSpace(b.String())
+	if len(link) == 0 {
+		return caption
+	}
+
+	return fmt.Sprintf("%s\nlogs: %s", caption, link)
+}
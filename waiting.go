@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// podWaiting holds waiting reason already notified for every container of
+// pod.
+type podWaiting struct {
+	uid     types.UID
+	reasons map[string]string
+}
+
+var (
+	waitingMu sync.Mutex
+	// waitingPods holds notified waiting reasons by pod key
+	waitingPods = map[string]*podWaiting{}
+)
+
+// isWaitingReasonNotified reports whether reason is one of
+// --notify-waiting-reasons.
+func isWaitingReasonNotified(reason string) bool {
+	for _, r := range notifyWaitingReasons {
+		if r == reason {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processWaitingContainer sends description of container stuck in waiting
+// state once for every waiting reason.
+func processWaitingContainer(ctx context.Context, pod *v1.Pod, containerStatus v1.ContainerStatus) {
+	waiting := containerStatus.State.Waiting
+	if waiting == nil || !isWaitingReasonNotified(waiting.Reason) {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s", pod.GetNamespace(), pod.GetName())
+
+	waitingMu.Lock()
+	w, ok := waitingPods[key]
+	if !ok || w.uid != pod.GetUID() {
+		w = &podWaiting{uid: pod.GetUID(), reasons: map[string]string{}}
+		waitingPods[key] = w
+	}
+	if w.reasons[containerStatus.Name] == waiting.Reason {
+		waitingMu.Unlock()
+		return
+	}
+	w.reasons[containerStatus.Name] = waiting.Reason
+	waitingMu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "pod: %s/%s\n", pod.GetNamespace(), pod.GetName())
+	fmt.Fprintf(&b, "container %s: waiting, reason: %s\n", containerStatus.Name, waiting.Reason)
+	if len(waiting.Message) > 0 {
+		fmt.Fprintf(&b, "message: %s\n", waiting.Message)
+	}
+	fmt.Fprintf(&b, "image: %s\n", containerStatus.Image)
+
+	klog.Infof("Send waiting of pod: %s, container: %s, reason: %s", pod.GetName(), containerStatus.Name, waiting.Reason)
+
+	err := sendMessage(ctx, pod, b.String())
+	if err != nil {
+		klog.Errorf("[processWaitingContainer] failed send container waiting: %s", err)
+		recordSendError(pod, err)
+
+		waitingMu.Lock()
+		delete(w.reasons, containerStatus.Name)
+		waitingMu.Unlock()
+	}
+}
+
+// processWaitingContainers notifies about matched pod containers waiting
+// with one of --notify-waiting-reasons.
+func processWaitingContainers(ctx context.Context, pod *v1.Pod) {
+	if len(notifyWaitingReasons) == 0 {
+		return
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if isContainerMatched(pod, containerStatus) {
+			processWaitingContainer(ctx, pod, containerStatus)
+		}
+	}
+}
+
+// forgetWaiting removes deleted pod from notified waiting reasons.
+func forgetWaiting(key string) {
+	waitingMu.Lock()
+	delete(waitingPods, key)
+	waitingMu.Unlock()
+}
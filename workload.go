@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// workloadRef is workload selected by --workload, empty kind matches any
+// kind of workload.
+type workloadRef struct {
+	kind string
+	name string
+}
+
+func (w workloadRef) String() string {
+	if len(w.kind) == 0 {
+		return w.name
+	}
+
+	return fmt.Sprintf("%s/%s", w.kind, w.name)
+}
+
+// parseWorkloads parses list of workloads in format [kind/]name.
+func parseWorkloads(list []string) ([]workloadRef, error) {
+	var refs []workloadRef
+
+	for _, w := range list {
+		ref := workloadRef{name: w}
+		if i := strings.Index(w, "/"); i >= 0 {
+			ref = workloadRef{kind: w[:i], name: w[i+1:]}
+		}
+
+		if len(ref.name) == 0 {
+			return nil, fmt.Errorf("[parseWorkloads] invalid workload %q, expected format: [kind/]name", w)
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// podWorkloads returns controllers of pod. Deployment is resolved from
+// ReplicaSet name and pod-template-hash label, so no api calls are needed.
+func podWorkloads(pod *v1.Pod) []workloadRef {
+	var refs []workloadRef
+
+	for _, owner := range pod.GetOwnerReferences() {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+
+		refs = append(refs, workloadRef{kind: owner.Kind, name: owner.Name})
+
+		hash := pod.GetLabels()["pod-template-hash"]
+		if owner.Kind == "ReplicaSet" && len(hash) > 0 && strings.HasSuffix(owner.Name, "-"+hash) {
+			refs = append(refs, workloadRef{kind: "Deployment", name: strings.TrimSuffix(owner.Name, "-"+hash)})
+		}
+	}
+
+	return refs
+}
+
+// isWorkloadShouldCheck reports whether pod belongs to one of --workload.
+func isWorkloadShouldCheck(pod *v1.Pod) bool {
+	if len(workloadRefs) == 0 {
+		return true
+	}
+
+	for _, ref := range podWorkloads(pod) {
+		for _, w := range workloadRefs {
+			if w.name == ref.name && (len(w.kind) == 0 || strings.EqualFold(w.kind, ref.kind)) {
+				klog.V(4).Infof("Pod %s is checked, matched workload: %s", pod.GetName(), w)
+				return true
+			}
+		}
+	}
+
+	klog.V(4).Infof("Pod %s is skipped, no workload matched", pod.GetName())
+	return false
+}